@@ -0,0 +1,135 @@
+package mbserver
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+const commEventLogSize = 64
+
+// Event bytes stored in the communication event log.
+const (
+	receiveEvent       uint8 = 0x80
+	receiveCommError   uint8 = 0x02
+	receiveOverrun     uint8 = 0x10
+	receiveListenOnly  uint8 = 0x20
+	receiveBroadcast   uint8 = 0x40
+	sendEvent          uint8 = 0x40
+	sendReadException  uint8 = 0x01
+	sendAbortException uint8 = 0x02
+	sendBusyException  uint8 = 0x04
+	sendNAKException   uint8 = 0x08
+	sendListenOnly     uint8 = 0x20
+	listenOnlyEvent    uint8 = 0x04
+	restartEvent       uint8 = 0x00
+)
+
+// commEvents holds the communication event counter and the event log
+// returned by Get Comm Event Counter and Get Comm Event Log.
+type commEvents struct {
+	sync.Mutex
+	counter uint16
+	log     [commEventLogSize]byte //ring buffer, head points to the next free entry
+	head    int
+	length  int
+}
+
+// add stores an event in the log, the oldest event is overwritten if the log is full.
+func (e *commEvents) add(event uint8) {
+	e.Lock()
+	defer e.Unlock()
+	e.log[e.head] = event
+	e.head = (e.head + 1) % commEventLogSize
+	if e.length < commEventLogSize {
+		e.length++
+	}
+}
+
+func (e *commEvents) count() {
+	e.Lock()
+	e.counter++
+	e.Unlock()
+}
+
+// clear resets the event counter and, if clearLog is set, the event log.
+func (e *commEvents) clear(clearLog bool) {
+	e.Lock()
+	defer e.Unlock()
+	e.counter = 0
+	if clearLog {
+		e.head = 0
+		e.length = 0
+	}
+}
+
+// events returns the logged events with the most recent event first.
+func (e *commEvents) events() []byte {
+	e.Lock()
+	defer e.Unlock()
+	events := make([]byte, e.length)
+	for i := range events {
+		events[i] = e.log[(e.head-1-i+commEventLogSize)%commEventLogSize]
+	}
+	return events
+}
+
+// logReceiveEvent stores a receive event with the given flags in the event log.
+func (s *Server) logReceiveEvent(flags uint8) {
+	if s.diag.isListenOnly() {
+		flags |= receiveListenOnly
+	}
+	s.events.add(receiveEvent | flags)
+}
+
+// logSendEvent stores a send event for a response with the given exception in the event log.
+func (s *Server) logSendEvent(exception *Exception) {
+	flags := sendEvent
+
+	if s.diag.isListenOnly() {
+		s.events.add(flags | sendListenOnly)
+		return
+	}
+
+	switch *exception {
+	case IllegalFunction, IllegalDataAddress, IllegalDataValue:
+		flags |= sendReadException
+	case SlaveDeviceFailure:
+		flags |= sendAbortException
+	case AcknowledgeSlave, SlaveDeviceBusy:
+		flags |= sendBusyException
+	case NegativeAcknowledge:
+		flags |= sendNAKException
+	}
+	s.events.add(flags)
+}
+
+// GetCommEventCounter function 11, returns the status word and the number of successfully
+// completed requests.
+func GetCommEventCounter(s *Server, frame Framer) ([]byte, *Exception) {
+	s.events.Lock()
+	defer s.events.Unlock()
+
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint16(data[2:4], s.events.counter)
+	return data, &Success
+}
+
+// GetCommEventLog function 12, returns the status word, the event counter, the message
+// counter and the event log with the most recent event first.
+func GetCommEventLog(s *Server, frame Framer) ([]byte, *Exception) {
+	events := s.events.events()
+
+	s.events.Lock()
+	counter := s.events.counter
+	s.events.Unlock()
+
+	s.diag.Lock()
+	messages := s.diag.busMessages
+	s.diag.Unlock()
+
+	data := make([]byte, 7, 7+len(events))
+	data[0] = byte(6 + len(events))
+	binary.BigEndian.PutUint16(data[3:5], counter)
+	binary.BigEndian.PutUint16(data[5:7], messages)
+	return append(data, events...), &Success
+}
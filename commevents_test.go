@@ -0,0 +1,81 @@
+package mbserver
+
+import "testing"
+
+func TestGetCommEventCounter(t *testing.T) {
+	s, _ := NewServer(255)
+	s.HoldingRegisters = make([]byte, 10)
+
+	var frame TCPFrame
+	frame.Function = WriteHoldingRegister_fc
+	SetDataWithRegisterAndNumber(&frame, 1, 6)
+	s.handle(&Request{frame: &frame})
+
+	// out of bounds, exception responses are not counted
+	SetDataWithRegisterAndNumber(&frame, 10, 6)
+	s.handle(&Request{frame: &frame})
+
+	frame.Function = GetCommEventCounter_fc
+	frame.Data = []byte{}
+	response := s.handle(&Request{frame: &frame})
+	expect := []byte{0, 0, 0, 1}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestGetCommEventLog(t *testing.T) {
+	s, _ := NewServer(255)
+	s.Coils = make([]byte, 10)
+
+	var frame TCPFrame
+	frame.Function = ReadCoils_fc
+	SetDataWithRegisterAndNumber(&frame, 20, 1)
+	s.handle(&Request{frame: &frame})
+
+	frame.Function = GetCommEventLog_fc
+	frame.Data = []byte{}
+	response := s.handle(&Request{frame: &frame})
+
+	// most recent event first: receive of this request, read exception sent, receive of the read
+	expect := []byte{9, 0, 0, 0, 0, 0, 0, receiveEvent, sendEvent | sendReadException, receiveEvent}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestGetCommEventCounterOverTCP(t *testing.T) {
+	s, _ := NewServer(1)
+	s.HoldingRegisters = make([]byte, 10)
+	defer s.Close()
+
+	// A master checks whether its write was executed by polling the event counter.
+	serveTCPRequest(t, s, 1, WriteHoldingRegister_fc, []byte{0, 1, 0, 6})
+	response := serveTCPRequest(t, s, 1, GetCommEventCounter_fc, nil)
+	expect := []byte{0, 0, 0, 1}
+	if response.Function != GetCommEventCounter_fc || !isEqual(expect, response.Data) {
+		t.Errorf("expected %v, got %v %v", expect, response.Function, response.Data)
+	}
+
+	response = serveTCPRequest(t, s, 1, GetCommEventLog_fc, nil)
+	if response.Function != GetCommEventLog_fc || len(response.Data) < 5 || !isEqual(expect[2:], response.Data[3:5]) {
+		t.Errorf("expected the log with event count 1, got %v %v", response.Function, response.Data)
+	}
+}
+
+func TestCommEventLogRingBuffer(t *testing.T) {
+	var events commEvents
+	for i := 0; i < commEventLogSize+2; i++ {
+		events.add(uint8(i))
+	}
+
+	got := events.events()
+	if len(got) != commEventLogSize {
+		t.Fatalf("expected %d events, got %d", commEventLogSize, len(got))
+	}
+	if got[0] != commEventLogSize+1 || got[commEventLogSize-1] != 2 {
+		t.Errorf("expected events from %d to 2, got %v", commEventLogSize+1, got)
+	}
+}
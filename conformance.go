@@ -0,0 +1,100 @@
+package mbserver
+
+import "encoding/binary"
+
+// checkRequest validates the quantities, byte counts and values of a request as required by the
+// exception state diagrams of the Modbus specification. The function handlers check the addresses
+// afterwards, so IllegalDataValue is reported before IllegalDataAddress. Without strict conformance
+// mode and for function codes unknown to the library every request passes.
+func (s *Server) checkRequest(frame Framer) *Exception {
+	if !s.StrictConformance {
+		return &Success
+	}
+
+	data := frame.GetData()
+
+	switch frame.GetFunction() {
+	case ReadCoils_fc, ReadDiscreteInput_fc:
+		return checkQuantity(data, 2000)
+
+	case ReadHoldingRegisters_fc, ReadInputRegisters_fc:
+		return checkQuantity(data, 125)
+
+	case WriteSingleCoil_fc:
+		if len(data) != 4 {
+			return &IllegalDataValue
+		}
+		if value := binary.BigEndian.Uint16(data[2:4]); value != 0x0000 && value != 0xFF00 {
+			return &IllegalDataValue
+		}
+
+	case WriteHoldingRegister_fc:
+		if len(data) != 4 {
+			return &IllegalDataValue
+		}
+
+	case WriteMultipleCoils_fc:
+		if len(data) < 5 || len(data) != 5+int(data[4]) {
+			return &IllegalDataValue
+		}
+		if numRegs := int(binary.BigEndian.Uint16(data[2:4])); numRegs < 1 || numRegs > 1968 || int(data[4]) != (numRegs+7)/8 {
+			return &IllegalDataValue
+		}
+
+	case WriteHoldingRegisters_fc:
+		if len(data) < 5 || len(data) != 5+int(data[4]) {
+			return &IllegalDataValue
+		}
+		if numRegs := int(binary.BigEndian.Uint16(data[2:4])); numRegs < 1 || numRegs > 123 || int(data[4]) != numRegs*2 {
+			return &IllegalDataValue
+		}
+
+	case MaskWriteRegister_fc:
+		if len(data) != 6 {
+			return &IllegalDataValue
+		}
+
+	case ReadWriteMultipleRegisters_fc:
+		if len(data) < 9 || len(data) != 9+int(data[8]) {
+			return &IllegalDataValue
+		}
+
+	case ReadFifoQueue_fc:
+		if len(data) != 2 {
+			return &IllegalDataValue
+		}
+
+	case ReadExceptionStatus_fc, GetCommEventCounter_fc, GetCommEventLog_fc, ReportSlaveId_fc:
+		if len(data) != 0 {
+			return &IllegalDataValue
+		}
+
+	case Diagnostics_fc:
+		if len(data) < 4 || len(data) != 4 && binary.BigEndian.Uint16(data[0:2]) != ReturnQueryData_sub {
+			return &IllegalDataValue
+		}
+
+	case ReadFileRecord_fc, WriteFileRecord_fc:
+		if len(data) < 1 || len(data) != 1+int(data[0]) {
+			return &IllegalDataValue
+		}
+
+	case ReadDeviceIdentification_fc:
+		if len(data) < 1 || data[0] == ReadDeviceIdentification_mei && len(data) != 3 {
+			return &IllegalDataValue
+		}
+	}
+
+	return &Success
+}
+
+// checkQuantity checks the length of a read request and that its quantity is in the range 1 to max.
+func checkQuantity(data []byte, max int) *Exception {
+	if len(data) != 4 {
+		return &IllegalDataValue
+	}
+	if numRegs := int(binary.BigEndian.Uint16(data[2:4])); numRegs < 1 || numRegs > max {
+		return &IllegalDataValue
+	}
+	return &Success
+}
@@ -0,0 +1,52 @@
+package mbserver
+
+import "testing"
+
+func TestStrictConformance(t *testing.T) {
+	s, _ := NewServer(255)
+	s.Coils = make([]byte, 100)
+	s.HoldingRegisters = make([]byte, 200)
+	s.StrictConformance = true
+
+	var frame TCPFrame
+	frame.TransactionIdentifier = 1
+	frame.ProtocolIdentifier = 0
+	frame.Device = 255
+
+	var req Request
+	req.frame = &frame
+
+	tests := []struct {
+		name      string
+		function  uint8
+		data      []byte
+		exception Exception
+	}{
+		{"read 0 coils", ReadCoils_fc, []byte{0, 0, 0, 0}, IllegalDataValue},
+		{"read 2001 coils", ReadCoils_fc, []byte{0, 0, 0x07, 0xD1}, IllegalDataValue},
+		// the quantity is checked before the address
+		{"read 2001 coils out of bounds", ReadCoils_fc, []byte{0xFF, 0, 0x07, 0xD1}, IllegalDataValue},
+		{"read coils out of bounds", ReadCoils_fc, []byte{0xFF, 0, 0, 1}, IllegalDataAddress},
+		{"read 126 registers", ReadHoldingRegisters_fc, []byte{0, 0, 0, 126}, IllegalDataValue},
+		{"read 100 registers", ReadHoldingRegisters_fc, []byte{0, 0, 0, 100}, Success},
+		{"write coil 0xFFFF", WriteSingleCoil_fc, []byte{0, 1, 0xFF, 0xFF}, IllegalDataValue},
+		{"write coil 0xFF00", WriteSingleCoil_fc, []byte{0, 1, 0xFF, 0x00}, Success},
+		{"write coils with wrong byte count", WriteMultipleCoils_fc, []byte{0, 1, 0, 9, 1, 0xFF}, IllegalDataValue},
+		{"write 9 coils", WriteMultipleCoils_fc, []byte{0, 1, 0, 9, 2, 0xFF, 0x01}, Success},
+		{"write 124 registers", WriteHoldingRegisters_fc, append([]byte{0, 0, 0, 124, 248}, make([]byte, 248)...), IllegalDataValue},
+		{"write registers with wrong byte count", WriteHoldingRegisters_fc, []byte{0, 0, 0, 2, 2, 0, 1}, IllegalDataValue},
+		{"short request", WriteHoldingRegister_fc, []byte{0, 1, 0}, IllegalDataValue},
+		{"read exception status with data", ReadExceptionStatus_fc, []byte{0}, IllegalDataValue},
+		{"unknown function", 100, []byte{}, IllegalFunction},
+	}
+
+	for _, test := range tests {
+		frame.Function = test.function
+		frame.SetData(test.data)
+		response := s.handle(&req)
+		exception := GetException(response)
+		if exception != test.exception {
+			t.Errorf("%s: expected %v, got %v", test.name, test.exception.String(), exception.String())
+		}
+	}
+}
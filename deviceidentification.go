@@ -0,0 +1,131 @@
+package mbserver
+
+// MEI type of the Read Device Identification request.
+const ReadDeviceIdentification_mei uint8 = 0x0E
+
+// Read Device ID codes of the Read Device Identification request.
+const (
+	ReadDeviceIdBasic_code      uint8 = 1
+	ReadDeviceIdRegular_code    uint8 = 2
+	ReadDeviceIdExtended_code   uint8 = 3
+	ReadDeviceIdIndividual_code uint8 = 4
+)
+
+// Object ids of the device identification.
+// Objects 0x80 to 0xFF are private and can be used for vendor specific data.
+const (
+	VendorName_obj          uint8 = 0x00
+	ProductCode_obj         uint8 = 0x01
+	MajorMinorRevision_obj  uint8 = 0x02
+	VendorUrl_obj           uint8 = 0x03
+	ProductName_obj         uint8 = 0x04
+	ModelName_obj           uint8 = 0x05
+	UserApplicationName_obj uint8 = 0x06
+)
+
+const (
+	lastBasic_obj   uint8 = 0x02
+	lastRegular_obj uint8 = 0x7F
+
+	// function code, MEI type, read device id code, conformity level, more follows, next object id and number of objects
+	deviceIdHeaderSize = 7
+)
+
+// ReadDeviceIdentification function 43 / MEI type 14, reads the identification objects
+// stored in Server.DeviceIdentification.
+// The basic objects (vendor name, product code and revision) are mandatory and are
+// answered with an empty value if they have not been set.
+func ReadDeviceIdentification(s *Server, frame Framer) ([]byte, *Exception) {
+	data := frame.GetData()
+	if len(data) < 3 {
+		return []byte{}, &IllegalDataValue
+	}
+	if data[0] != ReadDeviceIdentification_mei {
+		return []byte{}, &IllegalFunction
+	}
+
+	code, objectId := data[1], data[2]
+	var last uint8
+
+	switch code {
+	case ReadDeviceIdBasic_code:
+		last = lastBasic_obj
+	case ReadDeviceIdRegular_code:
+		last = lastRegular_obj
+	case ReadDeviceIdExtended_code:
+		last = 0xFF
+	case ReadDeviceIdIndividual_code:
+		value, ok := s.deviceIdentificationObject(objectId)
+		if !ok {
+			return []byte{}, &IllegalDataAddress
+		}
+		response := []byte{ReadDeviceIdentification_mei, code, s.deviceIdConformityLevel(), 0x00, 0x00, 1}
+		return appendDeviceIdObject(response, objectId, value, max_PDU-deviceIdHeaderSize), &Success
+	default:
+		return []byte{}, &IllegalDataValue
+	}
+
+	// Stream access restarts at the beginning if the requested object does not exist.
+	if _, ok := s.deviceIdentificationObject(objectId); !ok || objectId > last {
+		objectId = VendorName_obj
+	}
+
+	response := []byte{ReadDeviceIdentification_mei, code, s.deviceIdConformityLevel(), 0x00, 0x00, 0}
+	space := max_PDU - deviceIdHeaderSize
+
+	for id := int(objectId); id <= int(last); id++ {
+		value, ok := s.deviceIdentificationObject(uint8(id))
+		if !ok {
+			continue
+		}
+
+		if 2+len(value) > space && response[5] > 0 {
+			// more follows, continue with this object in the next transaction
+			response[3] = 0xFF
+			response[4] = uint8(id)
+			break
+		}
+
+		n := len(response)
+		response = appendDeviceIdObject(response, uint8(id), value, space)
+		space -= len(response) - n
+		response[5]++
+	}
+
+	return response, &Success
+}
+
+// deviceIdentificationObject returns the value of an identification object and
+// whether the object exists.
+func (s *Server) deviceIdentificationObject(objectId uint8) ([]byte, bool) {
+	value, ok := s.DeviceIdentification[objectId]
+	if !ok && objectId <= lastBasic_obj {
+		return []byte{}, true
+	}
+	return value, ok
+}
+
+// deviceIdConformityLevel returns the highest identification level for which objects
+// are available, individual access is always supported.
+func (s *Server) deviceIdConformityLevel() uint8 {
+	level := ReadDeviceIdBasic_code
+	for id := range s.DeviceIdentification {
+		if id > lastRegular_obj {
+			return 0x80 | ReadDeviceIdExtended_code
+		}
+		if id > lastBasic_obj {
+			level = ReadDeviceIdRegular_code
+		}
+	}
+	return 0x80 | level
+}
+
+// appendDeviceIdObject appends id, length and value of an object to the response
+// truncating the value if it does not fit into the remaining space.
+func appendDeviceIdObject(response []byte, objectId uint8, value []byte, space int) []byte {
+	if len(value) > space-2 {
+		value = value[:space-2]
+	}
+	response = append(response, objectId, uint8(len(value)))
+	return append(response, value...)
+}
@@ -0,0 +1,75 @@
+package mbserver
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadDeviceIdentificationBasic(t *testing.T) {
+	s, _ := NewServer(255)
+	s.DeviceIdentification[VendorName_obj] = []byte("ACME")
+	s.DeviceIdentification[ProductCode_obj] = []byte("PC1")
+	s.DeviceIdentification[MajorMinorRevision_obj] = []byte("1.0")
+	s.DeviceIdentification[ModelName_obj] = []byte("Model")
+
+	response := handleRequest(s, ReadDeviceIdentification_fc, []byte{ReadDeviceIdentification_mei, ReadDeviceIdBasic_code, 0})
+	exception := GetException(response)
+	if exception != Success {
+		t.Fatalf("expected Success, got %v", exception.String())
+	}
+
+	expect := []byte{0x0E, 1, 0x82, 0, 0, 3, 0, 4, 'A', 'C', 'M', 'E', 1, 3, 'P', 'C', '1', 2, 3, '1', '.', '0'}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestReadDeviceIdentificationIndividual(t *testing.T) {
+	s, _ := NewServer(255)
+	s.DeviceIdentification[0x80] = []byte{1, 2}
+
+	response := handleRequest(s, ReadDeviceIdentification_fc, []byte{ReadDeviceIdentification_mei, ReadDeviceIdIndividual_code, 0x80})
+	expect := []byte{0x0E, 4, 0x83, 0, 0, 1, 0x80, 2, 1, 2}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	response = handleRequest(s, ReadDeviceIdentification_fc, []byte{ReadDeviceIdentification_mei, ReadDeviceIdIndividual_code, 0x81})
+	exception := GetException(response)
+	if exception != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", exception.String())
+	}
+
+	response = handleRequest(s, ReadDeviceIdentification_fc, []byte{ReadDeviceIdentification_mei, 5, 0})
+	exception = GetException(response)
+	if exception != IllegalDataValue {
+		t.Errorf("expected IllegalDataValue, got %v", exception.String())
+	}
+}
+
+func TestReadDeviceIdentificationMoreFollows(t *testing.T) {
+	s, _ := NewServer(255)
+	for id := 0x80; id < 0x84; id++ {
+		s.DeviceIdentification[uint8(id)] = bytes.Repeat([]byte{uint8(id)}, 120)
+	}
+
+	response := handleRequest(s, ReadDeviceIdentification_fc, []byte{ReadDeviceIdentification_mei, ReadDeviceIdExtended_code, 0})
+	data := response.GetData()
+	if data[3] != 0xFF || data[4] != 0x81 || data[5] != 4 {
+		t.Fatalf("expected more follows at object 0x81 after 4 objects, got %v", data[:6])
+	}
+
+	response = handleRequest(s, ReadDeviceIdentification_fc, []byte{ReadDeviceIdentification_mei, ReadDeviceIdExtended_code, data[4]})
+	data = response.GetData()
+	if data[3] != 0xFF || data[4] != 0x83 || data[5] != 2 {
+		t.Fatalf("expected more follows at object 0x83 after 2 objects, got %v", data[:6])
+	}
+
+	response = handleRequest(s, ReadDeviceIdentification_fc, []byte{ReadDeviceIdentification_mei, ReadDeviceIdExtended_code, data[4]})
+	data = response.GetData()
+	if data[3] != 0 || data[4] != 0 || data[5] != 1 {
+		t.Errorf("expected last object without more follows, got %v", data[:6])
+	}
+}
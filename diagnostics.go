@@ -0,0 +1,163 @@
+package mbserver
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// Sub-function codes of the Diagnostics function.
+const (
+	ReturnQueryData_sub                  uint16 = 0x00
+	RestartCommunicationsOption_sub      uint16 = 0x01
+	ReturnDiagnosticRegister_sub         uint16 = 0x02
+	ForceListenOnlyMode_sub              uint16 = 0x04
+	ClearCounters_sub                    uint16 = 0x0A
+	ReturnBusMessageCount_sub            uint16 = 0x0B
+	ReturnBusCommunicationErrorCount_sub uint16 = 0x0C
+	ReturnBusExceptionErrorCount_sub     uint16 = 0x0D
+	ReturnServerMessageCount_sub         uint16 = 0x0E
+	ReturnServerNoResponseCount_sub      uint16 = 0x0F
+	ReturnServerNAKCount_sub             uint16 = 0x10
+	ReturnServerBusyCount_sub            uint16 = 0x11
+	ReturnBusCharacterOverrunCount_sub   uint16 = 0x12
+	ClearOverrunCounterAndFlag_sub       uint16 = 0x14
+)
+
+// diagnostics holds the counters and the state returned by the Diagnostics function.
+// The counters are updated by the transports and the request handler, therefore every
+// access has to be locked.
+type diagnostics struct {
+	sync.Mutex
+	register   uint16 //diagnostic register, content is device specific
+	listenOnly bool
+
+	busMessages       uint16
+	busCommErrors     uint16
+	busExceptions     uint16
+	serverMessages    uint16
+	serverNoResponses uint16
+	serverNAKs        uint16
+	serverBusy        uint16
+	charOverruns      uint16
+}
+
+// inc increments one of the counters of d.
+func (d *diagnostics) inc(counter *uint16) {
+	d.Lock()
+	*counter++
+	d.Unlock()
+}
+
+func (d *diagnostics) isListenOnly() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.listenOnly
+}
+
+// clear resets all counters and the diagnostic register.
+func (d *diagnostics) clear() {
+	d.register = 0
+	d.busMessages = 0
+	d.busCommErrors = 0
+	d.busExceptions = 0
+	d.serverMessages = 0
+	d.serverNoResponses = 0
+	d.serverNAKs = 0
+	d.serverBusy = 0
+	d.charOverruns = 0
+}
+
+// countException updates the counters for an exception response.
+func (d *diagnostics) countException(exception *Exception) {
+	d.Lock()
+	defer d.Unlock()
+	d.busExceptions++
+	switch *exception {
+	case NegativeAcknowledge:
+		d.serverNAKs++
+	case SlaveDeviceBusy:
+		d.serverBusy++
+	}
+}
+
+// SetDiagnosticRegister sets the value returned by the Return Diagnostic Register sub-function.
+func (s *Server) SetDiagnosticRegister(value uint16) {
+	s.diag.Lock()
+	s.diag.register = value
+	s.diag.Unlock()
+}
+
+// Diagnostics function 8, returns the communication counters and controls the listen only mode.
+func Diagnostics(s *Server, frame Framer) ([]byte, *Exception) {
+	data := frame.GetData()
+	if len(data) < 4 {
+		return []byte{}, &IllegalDataValue
+	}
+
+	subFunction := binary.BigEndian.Uint16(data[0:2])
+	value := binary.BigEndian.Uint16(data[2:4])
+	d := s.diag
+
+	d.Lock()
+	defer d.Unlock()
+
+	var counter uint16
+
+	switch subFunction {
+	case ReturnQueryData_sub:
+		return data, &Success
+	case RestartCommunicationsOption_sub:
+		if value != 0x0000 && value != 0xFF00 {
+			return []byte{}, &IllegalDataValue
+		}
+		d.listenOnly = false
+		d.clear()
+		s.events.clear(value == 0xFF00)
+		s.events.add(restartEvent)
+		return data[0:4], &Success
+	case ForceListenOnlyMode_sub:
+		if value != 0 {
+			return []byte{}, &IllegalDataValue
+		}
+		d.listenOnly = true
+		s.events.add(listenOnlyEvent)
+		return data[0:4], &Success
+	}
+
+	if value != 0 {
+		return []byte{}, &IllegalDataValue
+	}
+
+	switch subFunction {
+	case ReturnDiagnosticRegister_sub:
+		counter = d.register
+	case ClearCounters_sub:
+		d.clear()
+		s.events.clear(false)
+	case ReturnBusMessageCount_sub:
+		counter = d.busMessages
+	case ReturnBusCommunicationErrorCount_sub:
+		counter = d.busCommErrors
+	case ReturnBusExceptionErrorCount_sub:
+		counter = d.busExceptions
+	case ReturnServerMessageCount_sub:
+		counter = d.serverMessages
+	case ReturnServerNoResponseCount_sub:
+		counter = d.serverNoResponses
+	case ReturnServerNAKCount_sub:
+		counter = d.serverNAKs
+	case ReturnServerBusyCount_sub:
+		counter = d.serverBusy
+	case ReturnBusCharacterOverrunCount_sub:
+		counter = d.charOverruns
+	case ClearOverrunCounterAndFlag_sub:
+		d.charOverruns = 0
+	default:
+		return []byte{}, &IllegalFunction
+	}
+
+	response := make([]byte, 4)
+	binary.BigEndian.PutUint16(response[0:2], subFunction)
+	binary.BigEndian.PutUint16(response[2:4], counter)
+	return response, &Success
+}
@@ -0,0 +1,93 @@
+package mbserver
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDiagnosticsReturnQueryData(t *testing.T) {
+	s, _ := NewServer(255)
+
+	response := handleRequest(s, Diagnostics_fc, []byte{0, byte(ReturnQueryData_sub), 0xA5, 0x37})
+	expect := []byte{0, 0, 0xA5, 0x37}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestDiagnosticsCounters(t *testing.T) {
+	s, _ := NewServer(255)
+
+	handleRequest(s, Diagnostics_fc, []byte{0, 0x03, 0, 0})
+	s.SetDiagnosticRegister(0x1234)
+
+	response := handleRequest(s, Diagnostics_fc, []byte{0, byte(ReturnServerMessageCount_sub), 0, 0})
+	expect := []byte{0, 0x0E, 0, 2}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("ReturnServerMessageCount expected %v, got %v", expect, got)
+	}
+
+	response = handleRequest(s, Diagnostics_fc, []byte{0, byte(ReturnBusExceptionErrorCount_sub), 0, 0})
+	expect = []byte{0, 0x0D, 0, 1}
+	got = response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("ReturnBusExceptionErrorCount expected %v, got %v", expect, got)
+	}
+
+	response = handleRequest(s, Diagnostics_fc, []byte{0, byte(ReturnDiagnosticRegister_sub), 0, 0})
+	expect = []byte{0, 0x02, 0x12, 0x34}
+	got = response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("ReturnDiagnosticRegister expected %v, got %v", expect, got)
+	}
+
+	response = handleRequest(s, Diagnostics_fc, []byte{0, byte(ReturnBusExceptionErrorCount_sub), 0, 1})
+	exception := GetException(response)
+	if exception != IllegalDataValue {
+		t.Errorf("expected IllegalDataValue, got %v", exception.String())
+	}
+
+	handleRequest(s, Diagnostics_fc, []byte{0, byte(ClearCounters_sub), 0, 0})
+	response = handleRequest(s, Diagnostics_fc, []byte{0, byte(ReturnServerMessageCount_sub), 0, 0})
+	expect = []byte{0, 0x0E, 0, 1}
+	got = response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("ReturnServerMessageCount after ClearCounters expected %v, got %v", expect, got)
+	}
+}
+
+func TestDiagnosticsListenOnlyMode(t *testing.T) {
+	s, _ := NewServer(255)
+	s.HoldingRegisters = make([]byte, 10)
+
+	if response := handleRequest(s, Diagnostics_fc, []byte{0, byte(ForceListenOnlyMode_sub), 0, 0}); response != nil {
+		t.Fatalf("expected no response, got %v", response.Bytes())
+	}
+
+	var frame TCPFrame
+	frame.Function = WriteHoldingRegister_fc
+	SetDataWithRegisterAndNumber(&frame, 1, 6)
+	if response := s.handle(&Request{frame: &frame}); response != nil {
+		t.Errorf("expected no response, got %v", response.Bytes())
+	}
+	if !bytes.Equal(s.HoldingRegisters, make([]byte, 10)) {
+		t.Errorf("expected no write in listen only mode, got %v", s.HoldingRegisters)
+	}
+
+	if response := handleRequest(s, Diagnostics_fc, []byte{0, byte(RestartCommunicationsOption_sub), 0, 0}); response != nil {
+		t.Errorf("expected no response, got %v", response.Bytes())
+	}
+
+	response := handleRequest(s, Diagnostics_fc, []byte{0, byte(ReturnServerNoResponseCount_sub), 0, 0})
+	if response == nil {
+		t.Fatalf("expected response after Restart Communications Option")
+	}
+	// the counters are cleared by the restart, which is not answered itself
+	expect := []byte{0, 0x0F, 0, 1}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
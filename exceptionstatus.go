@@ -0,0 +1,48 @@
+package mbserver
+
+import "errors"
+
+// exceptionStatus returns the state of one exception status output.
+type exceptionStatus func(s *Server) bool
+
+// SetExceptionStatusCoil maps the exception status output bit (0-7) to the coil at address.
+func (s *Server) SetExceptionStatusCoil(bit uint, address uint16) error {
+	return s.setExceptionStatus(bit, func(s *Server) bool {
+		return int(address) < len(s.Coils) && s.Coils[address] != 0
+	})
+}
+
+// SetExceptionStatusDiscreteInput maps the exception status output bit (0-7) to the discrete input at address.
+func (s *Server) SetExceptionStatusDiscreteInput(bit uint, address uint16) error {
+	return s.setExceptionStatus(bit, func(s *Server) bool {
+		return int(address) < len(s.DiscreteInputs) && s.DiscreteInputs[address] != 0
+	})
+}
+
+// SetExceptionStatusFunc sets a callback which supplies the exception status output bit (0-7).
+// The callback is called from the request handler and must not block.
+func (s *Server) SetExceptionStatusFunc(bit uint, status func() bool) error {
+	return s.setExceptionStatus(bit, func(*Server) bool {
+		return status()
+	})
+}
+
+func (s *Server) setExceptionStatus(bit uint, status exceptionStatus) error {
+	if bit > 7 {
+		return errors.New("Exception status bit must be in the range 0 to 7")
+	}
+	s.exceptionStatus[bit] = status
+	return nil
+}
+
+// ReadExceptionStatus function 7, reads the eight exception status outputs.
+// Outputs which are not mapped are read as 0.
+func ReadExceptionStatus(s *Server, frame Framer) ([]byte, *Exception) {
+	var status byte
+	for bit, output := range s.exceptionStatus {
+		if output != nil && output(s) {
+			status |= 1 << uint(bit)
+		}
+	}
+	return []byte{status}, &Success
+}
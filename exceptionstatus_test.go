@@ -0,0 +1,57 @@
+package mbserver
+
+import "testing"
+
+// Function 7
+func TestReadExceptionStatus(t *testing.T) {
+	s, _ := NewServer(255)
+	s.Coils = make([]byte, 10)
+	s.DiscreteInputs = make([]byte, 10)
+
+	s.Coils[3] = 1
+	s.DiscreteInputs[4] = 1
+	s.SetExceptionStatusCoil(0, 3)
+	s.SetExceptionStatusCoil(1, 5)
+	s.SetExceptionStatusDiscreteInput(2, 4)
+	s.SetExceptionStatusCoil(3, 100)
+	s.SetExceptionStatusFunc(7, func() bool { return true })
+
+	if err := s.SetExceptionStatusFunc(8, func() bool { return true }); err == nil {
+		t.Errorf("expected error for bit 8, got nil")
+	}
+
+	var frame TCPFrame
+	frame.TransactionIdentifier = 1
+	frame.ProtocolIdentifier = 0
+	frame.Length = 2
+	frame.Device = 255
+	frame.Function = 7
+
+	var req Request
+	req.frame = &frame
+	response := s.handle(&req)
+	exception := GetException(response)
+	if exception != Success {
+		t.Errorf("expected Success, got %v", exception.String())
+		t.FailNow()
+	}
+	expect := []byte{0x85}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v\n", expect, got)
+	}
+}
+
+func TestReadExceptionStatusOverTCP(t *testing.T) {
+	s, _ := NewServer(1)
+	s.Coils = make([]byte, 10)
+	s.Coils[3] = 1
+	s.SetExceptionStatusCoil(0, 3)
+	defer s.Close()
+
+	response := serveTCPRequest(t, s, 1, ReadExceptionStatus_fc, nil)
+	expect := []byte{0x01}
+	if response.Function != ReadExceptionStatus_fc || !isEqual(expect, response.Data) {
+		t.Errorf("expected %v, got %v %v", expect, response.Function, response.Data)
+	}
+}
@@ -0,0 +1,113 @@
+package mbserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+// maxFifoCount is the maximum number of registers in a FIFO queue.
+const maxFifoCount = 31
+
+// FifoQueue is a queue of registers which is read by Read FIFO Queue at its pointer address.
+// The application pushes values into the queue while the server is running.
+type FifoQueue struct {
+	// ClearOnRead empties the queue after it has been read by a master. The Modbus
+	// specification reads the queue without clearing it, which is the default.
+	ClearOnRead bool
+
+	name    string
+	pointer uint16
+	mux     sync.Mutex
+	values  []uint16
+}
+
+// NewFifoQueue creates a FIFO queue which is read at the holding register address pointer.
+// FIFO queues should be created before the server starts listening.
+func (s *Server) NewFifoQueue(name string, pointer uint16) (*FifoQueue, error) {
+	if _, ok := s.fifos[pointer]; ok {
+		return nil, errors.New("FIFO pointer address is already in use")
+	}
+	if s.FifoQueue(name) != nil {
+		return nil, errors.New("FIFO queue " + name + " already exists")
+	}
+	q := &FifoQueue{name: name, pointer: pointer}
+	s.fifos[pointer] = q
+	return q, nil
+}
+
+// FifoQueue returns the FIFO queue with the given name or nil if there is none.
+func (s *Server) FifoQueue(name string) *FifoQueue {
+	for _, q := range s.fifos {
+		if q.name == name {
+			return q
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the queue.
+func (q *FifoQueue) Name() string {
+	return q.name
+}
+
+// Pointer returns the FIFO pointer address of the queue.
+func (q *FifoQueue) Pointer() uint16 {
+	return q.pointer
+}
+
+// Push appends values to the queue, nothing is appended if the queue would exceed 31 registers.
+func (q *FifoQueue) Push(values ...uint16) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	if len(q.values)+len(values) > maxFifoCount {
+		return errors.New("FIFO queue " + q.name + " is full")
+	}
+	q.values = append(q.values, values...)
+	return nil
+}
+
+// Len returns the number of registers in the queue.
+func (q *FifoQueue) Len() int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return len(q.values)
+}
+
+// Clear removes all registers from the queue.
+func (q *FifoQueue) Clear() {
+	q.mux.Lock()
+	q.values = q.values[:0]
+	q.mux.Unlock()
+}
+
+// ReadFifoQueue function 24, reads the count and the registers of the FIFO queue at the pointer address.
+func ReadFifoQueue(s *Server, frame Framer) ([]byte, *Exception) {
+	data := frame.GetData()
+	if len(data) < 2 {
+		return []byte{}, &IllegalDataValue
+	}
+
+	q, ok := s.fifos[binary.BigEndian.Uint16(data[0:2])]
+	if !ok {
+		return []byte{}, &IllegalDataAddress
+	}
+
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	count := len(q.values)
+	if count > maxFifoCount {
+		return []byte{}, &IllegalDataValue
+	}
+
+	response := make([]byte, 4, 4+count*2)
+	binary.BigEndian.PutUint16(response[0:2], uint16(2+count*2))
+	binary.BigEndian.PutUint16(response[2:4], uint16(count))
+	response = append(response, Uint16ToBytes(q.values)...)
+
+	if q.ClearOnRead {
+		q.values = q.values[:0]
+	}
+	return response, &Success
+}
@@ -0,0 +1,58 @@
+package mbserver
+
+import "testing"
+
+func TestReadFifoQueue(t *testing.T) {
+	s, _ := NewServer(255)
+
+	q, err := s.NewFifoQueue("samples", 0x04DE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.NewFifoQueue("other", 0x04DE); err == nil {
+		t.Errorf("expected error for pointer address in use, got nil")
+	}
+	if s.FifoQueue("samples") != q {
+		t.Errorf("expected FifoQueue to return the samples queue")
+	}
+
+	q.Push(0x01B8, 0x1284)
+
+	var frame TCPFrame
+	frame.TransactionIdentifier = 1
+	frame.ProtocolIdentifier = 0
+	frame.Length = 4
+	frame.Device = 255
+	frame.Function = ReadFifoQueue_fc
+	frame.Data = []byte{0x04, 0xDE}
+
+	var req Request
+	req.frame = &frame
+	response := s.handle(&req)
+	// Example of the specification
+	expect := []byte{0, 6, 0, 2, 0x01, 0xB8, 0x12, 0x84}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+	if q.Len() != 2 {
+		t.Errorf("expected queue not to be cleared, got %d registers", q.Len())
+	}
+
+	q.ClearOnRead = true
+	s.handle(&req)
+	if q.Len() != 0 {
+		t.Errorf("expected queue to be cleared, got %d registers", q.Len())
+	}
+
+	if err = q.Push(make([]uint16, 32)...); err == nil {
+		t.Errorf("expected error for 32 registers, got nil")
+	}
+
+	frame.Data = []byte{0x04, 0xDF}
+	response = s.handle(&req)
+	exception := GetException(response)
+	if exception != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", exception.String())
+	}
+}
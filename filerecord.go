@@ -0,0 +1,122 @@
+package mbserver
+
+import "encoding/binary"
+
+// fileRecordReferenceType is the only reference type allowed in file record sub-requests.
+const fileRecordReferenceType uint8 = 6
+
+// fileSubRequest is one sub-request of a Read File Record or Write File Record request.
+type fileSubRequest struct {
+	file   uint16
+	record uint16
+	length uint16
+	values []byte //record data of Write File Record
+}
+
+// parseFileSubRequest reads the reference type, file, record number and record length
+// of a sub-request and checks them against the limits of the specification.
+func parseFileSubRequest(data []byte) (fileSubRequest, *Exception) {
+	sub := fileSubRequest{
+		file:   binary.BigEndian.Uint16(data[1:3]),
+		record: binary.BigEndian.Uint16(data[3:5]),
+		length: binary.BigEndian.Uint16(data[5:7]),
+	}
+	if data[0] != fileRecordReferenceType || sub.file == 0 || sub.length == 0 ||
+		int(sub.record)+int(sub.length) > maxFileRecords {
+		return sub, &IllegalDataAddress
+	}
+	return sub, &Success
+}
+
+// fileStoreException converts an error of a FileStore into a Modbus exception.
+func fileStoreException(err error) *Exception {
+	if exception, ok := err.(Exception); ok {
+		return &exception
+	}
+	return &SlaveDeviceFailure
+}
+
+// ReadFileRecord function 20, reads records from the files in Server.Files.
+func ReadFileRecord(s *Server, frame Framer) ([]byte, *Exception) {
+	if s.Files == nil {
+		return []byte{}, &IllegalFunction
+	}
+
+	data := frame.GetData()
+	if len(data) < 1 {
+		return []byte{}, &IllegalDataValue
+	}
+	byteCount := int(data[0])
+	if byteCount < 0x07 || byteCount > 0xF5 || byteCount%7 != 0 || len(data) < 1+byteCount {
+		return []byte{}, &IllegalDataValue
+	}
+
+	response := []byte{0}
+	for i := 1; i < 1+byteCount; i += 7 {
+		sub, exception := parseFileSubRequest(data[i : i+7])
+		if exception != &Success {
+			return []byte{}, exception
+		}
+
+		// function code, response length, file response length and reference type
+		if 1+len(response)+2+2*int(sub.length) > max_PDU {
+			return []byte{}, &IllegalDataValue
+		}
+
+		values, err := s.Files.ReadRecords(sub.file, sub.record, sub.length)
+		if err != nil {
+			return []byte{}, fileStoreException(err)
+		}
+		response = append(response, byte(1+2*len(values)), fileRecordReferenceType)
+		response = append(response, Uint16ToBytes(values)...)
+	}
+	response[0] = byte(len(response) - 1)
+
+	return response, &Success
+}
+
+// WriteFileRecord function 21, writes records to the files in Server.Files.
+// All sub-requests are checked before the first one is written.
+func WriteFileRecord(s *Server, frame Framer) ([]byte, *Exception) {
+	if s.Files == nil {
+		return []byte{}, &IllegalFunction
+	}
+
+	data := frame.GetData()
+	if len(data) < 1 {
+		return []byte{}, &IllegalDataValue
+	}
+	byteCount := int(data[0])
+	if byteCount < 0x09 || byteCount > 0xFB || len(data) < 1+byteCount {
+		return []byte{}, &IllegalDataValue
+	}
+
+	var subRequests []fileSubRequest
+	for i := 1; i < 1+byteCount; {
+		if i+7 > 1+byteCount {
+			return []byte{}, &IllegalDataValue
+		}
+		sub, exception := parseFileSubRequest(data[i : i+7])
+		if exception != &Success {
+			return []byte{}, exception
+		}
+		i += 7
+
+		if i+2*int(sub.length) > 1+byteCount {
+			return []byte{}, &IllegalDataValue
+		}
+		sub.values = data[i : i+2*int(sub.length)]
+		i += 2 * int(sub.length)
+
+		subRequests = append(subRequests, sub)
+	}
+
+	for _, sub := range subRequests {
+		err := s.Files.WriteRecords(sub.file, sub.record, BytesToUint16(sub.values))
+		if err != nil {
+			return []byte{}, fileStoreException(err)
+		}
+	}
+
+	return data[:1+byteCount], &Success
+}
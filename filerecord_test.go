@@ -0,0 +1,83 @@
+package mbserver
+
+import "testing"
+
+func TestReadFileRecord(t *testing.T) {
+	s, _ := NewServer(255)
+	files := NewMemoryFileStore()
+	files.SetFile(4, []uint16{0, 0x0DFE, 0x0020, 3})
+	files.SetFile(3, []uint16{0, 1, 2, 3, 4, 5, 6, 7, 8, 0x33CD, 0x0040})
+	s.Files = files
+
+	// Example of the specification
+	response := handleRequest(s, ReadFileRecord_fc, []byte{0x0E, 6, 0, 4, 0, 1, 0, 2, 6, 0, 3, 0, 9, 0, 2})
+	exception := GetException(response)
+	if exception != Success {
+		t.Fatalf("expected Success, got %v", exception.String())
+	}
+	expect := []byte{0x0C, 0x05, 0x06, 0x0D, 0xFE, 0x00, 0x20, 0x05, 0x06, 0x33, 0xCD, 0x00, 0x40}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	response = handleRequest(s, ReadFileRecord_fc, []byte{0x07, 5, 0, 4, 0, 1, 0, 2})
+	exception = GetException(response)
+	if exception != IllegalDataAddress {
+		t.Errorf("reference type 5 expected IllegalDataAddress, got %v", exception.String())
+	}
+
+	response = handleRequest(s, ReadFileRecord_fc, []byte{0x07, 6, 0, 5, 0, 1, 0, 2})
+	exception = GetException(response)
+	if exception != IllegalDataAddress {
+		t.Errorf("missing file expected IllegalDataAddress, got %v", exception.String())
+	}
+
+	response = handleRequest(s, ReadFileRecord_fc, []byte{0x06, 6, 0, 4, 0, 1, 0})
+	exception = GetException(response)
+	if exception != IllegalDataValue {
+		t.Errorf("byte count 6 expected IllegalDataValue, got %v", exception.String())
+	}
+}
+
+func TestWriteFileRecord(t *testing.T) {
+	s, _ := NewServer(255)
+	files, err := NewDirFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Files = files
+
+	// Example of the specification
+	request := []byte{0x0D, 6, 0, 4, 0, 7, 0, 3, 0x06, 0xAF, 0x04, 0xBE, 0x10, 0x0D}
+	response := handleRequest(s, WriteFileRecord_fc, request)
+	exception := GetException(response)
+	if exception != Success {
+		t.Fatalf("expected Success, got %v", exception.String())
+	}
+	got := response.GetData()
+	if !isEqual(request, got) {
+		t.Errorf("expected %v, got %v", request, got)
+	}
+
+	values, err := files.ReadRecords(4, 6, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []uint16{0, 0x06AF, 0x04BE, 0x100D}
+	if !isEqual(expect, values) {
+		t.Errorf("expected %v, got %v", expect, values)
+	}
+
+	response = handleRequest(s, WriteFileRecord_fc, []byte{0x09, 6, 0, 4, 0x27, 0x0F, 0, 2, 0, 1})
+	exception = GetException(response)
+	if exception != IllegalDataAddress {
+		t.Errorf("record 9999 length 2 expected IllegalDataAddress, got %v", exception.String())
+	}
+
+	response = handleRequest(s, WriteFileRecord_fc, []byte{0x0B, 6, 0, 4, 0, 0, 0, 2, 0, 1})
+	exception = GetException(response)
+	if exception != IllegalDataValue {
+		t.Errorf("short record data expected IllegalDataValue, got %v", exception.String())
+	}
+}
@@ -0,0 +1,153 @@
+package mbserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// maxFileRecords is the number of records a file can hold, the records are numbered 0 to 9999.
+const maxFileRecords = 10000
+
+// FileStore stores the files accessed by Read File Record and Write File Record.
+// Files are numbered 1 to 65535 and hold up to 10000 16-bit records.
+// An error of type Exception is returned to the master as is, any other error
+// results in a SlaveDeviceFailure exception.
+type FileStore interface {
+	// ReadRecords reads length records of file starting at record.
+	ReadRecords(file uint16, record uint16, length uint16) ([]uint16, error)
+	// WriteRecords writes values to file starting at record.
+	WriteRecords(file uint16, record uint16, values []uint16) error
+}
+
+// MemoryFileStore is a FileStore which holds the files in memory.
+type MemoryFileStore struct {
+	mux   sync.Mutex
+	files map[uint16][]uint16
+}
+
+// NewMemoryFileStore returns an empty MemoryFileStore.
+func NewMemoryFileStore() *MemoryFileStore {
+	return &MemoryFileStore{files: make(map[uint16][]uint16)}
+}
+
+// SetFile replaces the records of file.
+func (m *MemoryFileStore) SetFile(file uint16, records []uint16) error {
+	if file == 0 || len(records) > maxFileRecords {
+		return fmt.Errorf("invalid file %d with %d records", file, len(records))
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.files[file] = append([]uint16{}, records...)
+	return nil
+}
+
+// File returns a copy of the records of file, nil if the file does not exist.
+func (m *MemoryFileStore) File(file uint16) []uint16 {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	records, ok := m.files[file]
+	if !ok {
+		return nil
+	}
+	return append([]uint16{}, records...)
+}
+
+// ReadRecords implements FileStore, reading beyond the end of a file is an IllegalDataAddress.
+func (m *MemoryFileStore) ReadRecords(file uint16, record uint16, length uint16) ([]uint16, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	records, ok := m.files[file]
+	if !ok || int(record)+int(length) > len(records) {
+		return nil, IllegalDataAddress
+	}
+	return append([]uint16{}, records[record:int(record)+int(length)]...), nil
+}
+
+// WriteRecords implements FileStore, files are created or extended as needed.
+func (m *MemoryFileStore) WriteRecords(file uint16, record uint16, values []uint16) error {
+	end := int(record) + len(values)
+	if file == 0 || end > maxFileRecords {
+		return IllegalDataAddress
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	records := m.files[file]
+	if end > len(records) {
+		records = append(records, make([]uint16, end-len(records))...)
+	}
+	copy(records[record:], values)
+	m.files[file] = records
+	return nil
+}
+
+// DirFileStore is a FileStore which keeps every file in a directory on disk.
+// File n is stored big endian in "fileNNNNN.rec".
+type DirFileStore struct {
+	mux sync.Mutex
+	dir string
+}
+
+// NewDirFileStore returns a DirFileStore for the existing directory dir.
+func NewDirFileStore(dir string) (*DirFileStore, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New(dir + " is not a directory")
+	}
+	return &DirFileStore{dir: dir}, nil
+}
+
+func (d *DirFileStore) path(file uint16) string {
+	return filepath.Join(d.dir, fmt.Sprintf("file%05d.rec", file))
+}
+
+// ReadRecords implements FileStore, reading beyond the end of a file is an IllegalDataAddress.
+func (d *DirFileStore) ReadRecords(file uint16, record uint16, length uint16) ([]uint16, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	f, err := os.Open(d.path(file))
+	if os.IsNotExist(err) {
+		return nil, IllegalDataAddress
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	bytes := make([]byte, 2*int(length))
+	_, err = f.ReadAt(bytes, 2*int64(record))
+	if err == io.EOF {
+		return nil, IllegalDataAddress
+	}
+	if err != nil {
+		return nil, err
+	}
+	return BytesToUint16(bytes), nil
+}
+
+// WriteRecords implements FileStore, files are created or extended as needed.
+func (d *DirFileStore) WriteRecords(file uint16, record uint16, values []uint16) error {
+	if file == 0 || int(record)+len(values) > maxFileRecords {
+		return IllegalDataAddress
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	f, err := os.OpenFile(d.path(file), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteAt(Uint16ToBytes(values), 2*int64(record))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,104 @@
+package mbserver
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const asciiStart = ':'
+const asciiEnd = "\r\n"
+
+// ASCIIFrame is the Modbus ASCII frame.
+type ASCIIFrame struct {
+	Address  uint8
+	Function uint8
+	Data     []byte
+	LRC      uint8
+}
+
+// NewASCIIFrame converts a packet starting with ':' and ending with CR LF to a Modbus ASCII frame.
+func NewASCIIFrame(packet []byte) (*ASCIIFrame, error) {
+	packetLen := len(packet)
+
+	// start, address, function code, LRC and end
+	if packetLen < 9 {
+		return nil, fmt.Errorf("ASCII Frame error: packet less than 9 bytes: %q", packet)
+	}
+	if packet[0] != asciiStart || !bytes.HasSuffix(packet, []byte(asciiEnd)) {
+		return nil, fmt.Errorf("ASCII Frame error: missing start or end characters: %q", packet)
+	}
+
+	body := make([]byte, hex.DecodedLen(packetLen-3))
+	if _, err := hex.Decode(body, packet[1:packetLen-2]); err != nil {
+		return nil, fmt.Errorf("ASCII Frame error: %v", err)
+	}
+
+	// Check the LRC.
+	lrcGot := body[len(body)-1]
+	lrcCalc := lrcModbus(body[:len(body)-1])
+	if lrcCalc != lrcGot {
+		return nil, fmt.Errorf("ASCII Frame error: LRC (expected 0x%x, got 0x%x)", lrcCalc, lrcGot)
+	}
+
+	frame := &ASCIIFrame{
+		Address:  uint8(body[0]),
+		Function: uint8(body[1]),
+		Data:     body[2 : len(body)-1],
+		LRC:      lrcGot,
+	}
+
+	return frame, nil
+}
+
+// Copy the ASCIIFrame.
+func (frame *ASCIIFrame) Copy() Framer {
+	copy := *frame
+	return &copy
+}
+
+// Bytes returns the Modbus byte stream based on the ASCIIFrame fields
+func (frame *ASCIIFrame) Bytes() []byte {
+	body := make([]byte, 2, 3+len(frame.Data))
+
+	body[0] = frame.Address
+	body[1] = frame.Function
+	body = append(body, frame.Data...)
+
+	// Add the LRC.
+	body = append(body, lrcModbus(body))
+
+	return []byte(string(asciiStart) + strings.ToUpper(hex.EncodeToString(body)) + asciiEnd)
+}
+
+// GetFunction returns the Modbus function code.
+func (frame *ASCIIFrame) GetFunction() uint8 {
+	return frame.Function
+}
+
+// GetData returns the ASCIIFrame Data byte field.
+func (frame *ASCIIFrame) GetData() []byte {
+	return frame.Data
+}
+
+// SetData sets the ASCIIFrame Data byte field.
+func (frame *ASCIIFrame) SetData(data []byte) {
+	frame.Data = data
+}
+
+// SetException sets the Modbus exception code in the frame.
+func (frame *ASCIIFrame) SetException(exception *Exception) {
+	frame.Function = frame.Function | 0x80
+	frame.Data = []byte{byte(*exception)}
+}
+
+// lrcModbus returns the longitudinal redundancy check of data, the two's complement
+// of the sum of all bytes.
+func lrcModbus(data []byte) uint8 {
+	var sum uint8
+	for _, b := range data {
+		sum += b
+	}
+	return -sum
+}
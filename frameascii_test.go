@@ -0,0 +1,55 @@
+package mbserver
+
+import "testing"
+
+func TestNewASCIIFrame(t *testing.T) {
+	// Read 2 holding registers from 0x006B at address 0x11
+	frame, err := NewASCIIFrame([]byte(":1103006B00027F\r\n"))
+	if !isEqual(nil, err) {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+
+	got := frame.Address
+	expect := 0x11
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	got = frame.Function
+	expect = 3
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	if !isEqual([]byte{0, 0x6B, 0, 2}, frame.Data) {
+		t.Errorf("expected %v, got %v", []byte{0, 0x6B, 0, 2}, frame.Data)
+	}
+}
+
+func TestNewASCIIFrameBadLRC(t *testing.T) {
+	_, err := NewASCIIFrame([]byte(":1103006B00027E\r\n"))
+	if err == nil {
+		t.Fatalf("expected error not nil, got %v", err)
+	}
+}
+
+func TestNewASCIIFrameMissingEnd(t *testing.T) {
+	_, err := NewASCIIFrame([]byte(":1103006B00027F\r"))
+	if err == nil {
+		t.Fatalf("expected error not nil, got %v", err)
+	}
+}
+
+func TestASCIIFrameBytes(t *testing.T) {
+	frame := &ASCIIFrame{
+		Address:  uint8(0x11),
+		Function: uint8(3),
+		Data:     []byte{0, 0x6B, 0, 2},
+	}
+
+	got := string(frame.Bytes())
+	expect := ":1103006B00027F\r\n"
+	if !isEqual(expect, got) {
+		t.Errorf("expected %q, got %q", expect, got)
+	}
+}
@@ -17,6 +17,7 @@ const (
 	WriteHoldingRegisters_fc uint8 = 16
 
 	ReadExceptionStatus_fc        uint8 = 7
+	Diagnostics_fc                uint8 = 8
 	GetCommEventCounter_fc        uint8 = 11
 	GetCommEventLog_fc            uint8 = 12
 	ReportSlaveId_fc              uint8 = 17
@@ -25,7 +26,7 @@ const (
 	MaskWriteRegister_fc          uint8 = 22
 	ReadWriteMultipleRegisters_fc uint8 = 23
 	ReadFifoQueue_fc              uint8 = 24
-	ReadDeviceIdentification_fc   uint8 = 43
+	ReadDeviceIdentification_fc   uint8 = 43 // Encapsulated Interface Transport, see RegisterMEIHandler
 )
 
 func functionCodeToString(fc uint8) string {
@@ -48,6 +49,8 @@ func functionCodeToString(fc uint8) string {
 		return "writeHoldingRegisters"
 	case ReadExceptionStatus_fc:
 		return "readExceptionStatus"
+	case Diagnostics_fc:
+		return "diagnostics"
 	case GetCommEventCounter_fc:
 		return "getCommEventCounter"
 	case GetCommEventLog_fc:
@@ -137,13 +140,13 @@ func ReadInputRegisters(s *Server, frame Framer) ([]byte, *Exception) {
 // WriteSingleCoil function 5, write a coil to internal memory.
 func WriteSingleCoil(s *Server, frame Framer) ([]byte, *Exception) {
 	register, value := RegisterAddressAndValue(frame)
-	// TODO Should we use 0 for off and 65,280 (FF00 in hexadecimal) for on?
+	// 0xFF00 switches the coil on, 0xFFFF is accepted as well unless the server is in strict conformance mode.
 
 	if !(len(s.Coils) > register) {
 		return []byte{}, &IllegalDataAddress
 	}
 
-	if value == 0 || value == 65535 {
+	if value == 0 || value == 0xFF00 || value == 0xFFFF {
 		if value == 0 {
 			s.Coils[register] = byte(0)
 		} else {
@@ -226,6 +229,55 @@ func WriteHoldingRegisters(s *Server, frame Framer) ([]byte, *Exception) {
 	return data, exception
 }
 
+// MaskWriteRegister function 22, modifies a holding register in internal memory with an AND mask and an OR mask.
+func MaskWriteRegister(s *Server, frame Framer) ([]byte, *Exception) {
+	data := frame.GetData()
+	if len(data) < 6 {
+		return []byte{}, &IllegalDataValue
+	}
+	register := int(binary.BigEndian.Uint16(data[0:2]))
+	andMask := binary.BigEndian.Uint16(data[2:4])
+	orMask := binary.BigEndian.Uint16(data[4:6])
+
+	if (register+1)*2 > len(s.HoldingRegisters) {
+		return []byte{}, &IllegalDataAddress
+	}
+
+	current := binary.BigEndian.Uint16(s.HoldingRegisters[register*2 : (register+1)*2])
+	value := (current & andMask) | (orMask &^ andMask)
+	binary.BigEndian.PutUint16(s.HoldingRegisters[register*2:(register+1)*2], value)
+	return data[0:6], &Success
+}
+
+// ReadWriteMultipleRegisters function 23, writes and then reads holding registers in one operation.
+func ReadWriteMultipleRegisters(s *Server, frame Framer) ([]byte, *Exception) {
+	data := frame.GetData()
+	if len(data) < 9 {
+		return []byte{}, &IllegalDataValue
+	}
+	readRegister := int(binary.BigEndian.Uint16(data[0:2]))
+	readNumRegs := int(binary.BigEndian.Uint16(data[2:4]))
+	writeRegister := int(binary.BigEndian.Uint16(data[4:6]))
+	writeNumRegs := int(binary.BigEndian.Uint16(data[6:8]))
+	byteCount := int(data[8])
+
+	if readNumRegs < 1 || readNumRegs > 125 || writeNumRegs < 1 || writeNumRegs > 121 ||
+		byteCount != writeNumRegs*2 || len(data) < 9+byteCount {
+		return []byte{}, &IllegalDataValue
+	}
+
+	if (readRegister+readNumRegs)*2 > len(s.HoldingRegisters) || (writeRegister+writeNumRegs)*2 > len(s.HoldingRegisters) {
+		return []byte{}, &IllegalDataAddress
+	}
+
+	copy(s.HoldingRegisters[writeRegister*2:], data[9:9+byteCount])
+
+	response := make([]byte, 1+readNumRegs*2)
+	response[0] = byte(readNumRegs * 2)
+	copy(response[1:], s.HoldingRegisters[readRegister*2:(readRegister+readNumRegs)*2])
+	return response, &Success
+}
+
 // BytesToUint16 converts a big endian array of bytes to an array of unit16s
 func BytesToUint16(bytes []byte) []uint16 {
 	values := make([]uint16, len(bytes)/2)
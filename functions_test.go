@@ -265,6 +265,101 @@ func TestWriteHoldingRegisters(t *testing.T) {
 	}
 }
 
+// Function 22
+func TestMaskWriteRegister(t *testing.T) {
+	s, _ := NewServer(255)
+	s.HoldingRegisters = make([]byte, 10)
+	s.HoldingRegisters[8] = 0x00
+	s.HoldingRegisters[9] = 0x12
+
+	var frame TCPFrame
+	frame.TransactionIdentifier = 1
+	frame.ProtocolIdentifier = 0
+	frame.Length = 8
+	frame.Device = 255
+	frame.Function = 22
+	// Example of the specification
+	frame.Data = []byte{0, 4, 0, 0xF2, 0, 0x25}
+
+	var req Request
+	req.frame = &frame
+	response := s.handle(&req)
+	exception := GetException(response)
+	if exception != Success {
+		t.Errorf("expected Success, got %v", exception.String())
+		t.FailNow()
+	}
+	expect := []byte{0, 0x17}
+	got := s.HoldingRegisters[8:10]
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v\n", expect, got)
+	}
+	if !isEqual(frame.Data, response.GetData()) {
+		t.Errorf("expected %v, got %v\n", frame.Data, response.GetData())
+	}
+
+	frame.Data = []byte{0, 5, 0, 0xF2, 0, 0x25}
+	response = s.handle(&req)
+	exception = GetException(response)
+	if exception != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", exception.String())
+	}
+}
+
+// Function 23
+func TestReadWriteMultipleRegisters(t *testing.T) {
+	s, _ := NewServer(255)
+	s.HoldingRegisters = make([]byte, 20)
+
+	var frame TCPFrame
+	frame.TransactionIdentifier = 1
+	frame.ProtocolIdentifier = 0
+	frame.Length = 15
+	frame.Device = 255
+	frame.Function = 23
+	// read 3 registers from 2, write 2 registers to 3
+	frame.Data = []byte{0, 2, 0, 3, 0, 3, 0, 2, 4, 0, 7, 0, 8}
+
+	var req Request
+	req.frame = &frame
+	response := s.handle(&req)
+	exception := GetException(response)
+	if exception != Success {
+		t.Errorf("expected Success, got %v", exception.String())
+		t.FailNow()
+	}
+	// the write is executed before the read
+	expect := []byte{6, 0, 0, 0, 7, 0, 8}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v\n", expect, got)
+	}
+
+	frame.Data = []byte{0, 2, 0, 3, 0, 3, 0, 2, 2, 0, 7}
+	response = s.handle(&req)
+	exception = GetException(response)
+	if exception != IllegalDataValue {
+		t.Errorf("byte count 2 expected IllegalDataValue, got %v", exception.String())
+	}
+
+	frame.Data = []byte{0, 2, 0, 126, 0, 3, 0, 1, 2, 0, 7}
+	response = s.handle(&req)
+	exception = GetException(response)
+	if exception != IllegalDataValue {
+		t.Errorf("read quantity 126 expected IllegalDataValue, got %v", exception.String())
+	}
+
+	frame.Data = []byte{0, 2, 0, 3, 0, 9, 0, 2, 4, 0, 7, 0, 8}
+	response = s.handle(&req)
+	exception = GetException(response)
+	if exception != IllegalDataAddress {
+		t.Errorf("write to register 9 expected IllegalDataAddress, got %v", exception.String())
+	}
+	if s.HoldingRegisters[19] != 0 {
+		t.Errorf("expected no write on exception, got %v", s.HoldingRegisters)
+	}
+}
+
 func TestBytesToUint16(t *testing.T) {
 	bytes := []byte{1, 2, 3, 4}
 	got := BytesToUint16(bytes)
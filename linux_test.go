@@ -1,47 +1,112 @@
+//go:build linux
 // +build linux
 
 package mbserver
 
-/*
-// The serial read and close has a known race condition.
-// https://github.com/golang/go/issues/10001
-func TestModbusRTU(t *testing.T) {
-	// Create a pair of virutal serial devices.
-	cmd := exec.Command("socat",
-		"pty,raw,echo=0,link=ttyFOO",
-		"pty,raw,echo=0,link=ttyBAR")
-	err := cmd.Start()
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+// ptyMaster is the master end of a pseudo-terminal pair. Like a serial port it returns a
+// timeout error if nothing is read within the timeout, 0 disables the timeout.
+type ptyMaster struct {
+	*os.File
+	timeout time.Duration
+}
+
+var _ serial.Port = (*ptyMaster)(nil)
+
+// Open applies the read timeout of the config, the pseudo-terminal is opened by openPTY.
+func (p *ptyMaster) Open(config *serial.Config) error {
+	p.timeout = config.Timeout
+	return nil
+}
+
+func (p *ptyMaster) Read(b []byte) (int, error) {
+	if p.timeout > 0 {
+		p.SetReadDeadline(time.Now().Add(p.timeout))
+	}
+	return p.File.Read(b)
+}
+
+// openPTY creates a pseudo-terminal pair through /dev/ptmx and returns its master end and the
+// path of its slave end, a virtual serial line without an external tool like socat.
+func openPTY(t *testing.T) (*ptyMaster, string) {
+	file, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
 	if err != nil {
-		log.Fatal(err)
+		t.Skipf("no pseudo-terminals: %v", err)
 	}
-	defer cmd.Wait()
-	defer cmd.Process.Kill()
 
-	// Allow the virutal serial devices to be created.
-	time.Sleep(10 * time.Millisecond)
+	var number uint32
+	var unlock int32
+	conn, err := file.SyscallConn()
+	if err == nil {
+		// Fd would switch the file to blocking mode, which disables the read deadlines.
+		conn.Control(func(fd uintptr) {
+			err = ioctl(fd, syscall.TIOCGPTN, unsafe.Pointer(&number))
+			if err == nil {
+				err = ioctl(fd, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock))
+			}
+		})
+	}
+	if err != nil {
+		file.Close()
+		t.Fatalf("failed to set up the pseudo-terminal: %v", err)
+	}
 
-	// Server
-	s, _ := NewServer(255)
+	return &ptyMaster{File: file}, fmt.Sprintf("/dev/pts/%d", number)
+}
 
-	s.Coils = make([]byte, 1000)
+// openPTYPair returns both ends of a pseudo-terminal pair as serial ports, the slave end is
+// opened with goburrow/serial and the config.
+func openPTYPair(t *testing.T, config serial.Config) (*ptyMaster, serial.Port) {
+	master, path := openPTY(t)
+	config.Address = path
+	slave, err := serial.Open(&config)
+	if err != nil {
+		master.Close()
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	return master, slave
+}
+
+func ioctl(fd uintptr, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
 
-	err = s.ListenRTU(&serial.Config{
-		Address:  "ttyFOO",
-		BaudRate: 115200,
-		DataBits: 8,
-		StopBits: 1,
-		Parity:   "N",
-		Timeout:  10 * time.Second})
+// listenPTY lets the server listen with ListenRTU on the master end.
+func listenPTY(t *testing.T, s *Server, master *ptyMaster, baudRate int) {
+	s.SerialOpener = SerialOpenerFunc(func(config *serial.Config) (SerialPort, error) {
+		return master, master.Open(config)
+	})
+	err := s.ListenRTU(&serial.Config{Address: "pty", BaudRate: baudRate})
 	if err != nil {
 		t.Fatalf("failed to listen, got %v\n", err)
 	}
-	defer s.Close()
+}
 
-	// Allow the server to start and to avoid a connection refused on the client
-	time.Sleep(1 * time.Millisecond)
+func TestModbusRTU(t *testing.T) {
+	master, path := openPTY(t)
+
+	// Server
+	s, _ := NewServer(1)
+	s.Coils = make([]byte, 1000)
+	listenPTY(t, s, master, 115200)
+	defer s.Close()
 
 	// Client
-	handler := modbus.NewRTUClientHandler("ttyBAR")
+	handler := modbus.NewRTUClientHandler(path)
 	handler.BaudRate = 115200
 	handler.DataBits = 8
 	handler.Parity = "N"
@@ -49,7 +114,7 @@ func TestModbusRTU(t *testing.T) {
 	handler.SlaveId = 1
 	handler.Timeout = 5 * time.Second
 	// Connect manually so that multiple requests are handled in one connection session
-	err = handler.Connect()
+	err := handler.Connect()
 	if err != nil {
 		t.Errorf("failed to connect, got %v\n", err)
 		t.FailNow()
@@ -75,4 +140,68 @@ func TestModbusRTU(t *testing.T) {
 		t.Errorf("expected %v, got %v", expect, got)
 	}
 }
-*/
+
+func TestRTUSilenceOverPTY(t *testing.T) {
+	master, slave := openPTYPair(t, serial.Config{BaudRate: 115200, Parity: "N", Timeout: 100 * time.Millisecond})
+	defer slave.Close()
+
+	s, _ := NewServer(1)
+	s.HoldingRegisters = make([]byte, 20)
+	s.HoldingRegisters[3] = 5
+	listenPTY(t, s, master, 115200)
+	defer s.Close()
+
+	request := (&RTUFrame{Address: 1, Function: 3, Data: []byte{0, 1, 0, 1}}).Bytes()
+
+	// A silence of more than 3.5 characters splits the request into two bad frames.
+	slave.Write(request[:4])
+	time.Sleep(20 * time.Millisecond)
+	slave.Write(request[4:])
+	time.Sleep(20 * time.Millisecond)
+
+	slave.Write(request)
+	response := make([]byte, 7)
+	read := 0
+	for read < len(response) {
+		n, err := slave.Read(response[read:])
+		if err != nil {
+			t.Fatalf("expected nil, got %v\n", err)
+		}
+		read += n
+	}
+	if expect := []byte{1, 3, 2, 0, 5}; !isEqual(expect, response[:5]) {
+		t.Errorf("expected %v, got %v", expect, response[:5])
+	}
+
+	stats, _ := s.PortStats("pty")
+	if stats.Frames != 1 || stats.CRCErrors != 2 {
+		t.Errorf("expected 1 frame and 2 CRC errors, got %+v", stats)
+	}
+}
+
+func TestRTUCloseOverPTY(t *testing.T) {
+	master, slave := openPTYPair(t, serial.Config{BaudRate: 115200, Parity: "N", Timeout: 100 * time.Millisecond})
+	defer slave.Close()
+
+	s, _ := NewServer(1)
+	states := make(chan PortState, 4)
+	s.PortStateChanged = func(address string, state PortState, err error) {
+		states <- state
+	}
+	listenPTY(t, s, master, 115200)
+
+	if state := <-states; state != PortConnected {
+		t.Errorf("expected %v, got %v", PortConnected, state)
+	}
+
+	// Close ends the blocked read of the port without reporting it as lost.
+	s.Close()
+	if _, err := master.Read(make([]byte, 1)); err == nil {
+		t.Errorf("expected the port to be closed")
+	}
+	select {
+	case state := <-states:
+		t.Errorf("expected no state change, got %v", state)
+	case <-time.After(2 * minReconnectDelay):
+	}
+}
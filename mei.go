@@ -0,0 +1,58 @@
+package mbserver
+
+// MEI type of the CANopen General Reference request.
+const CANopenGeneralReference_mei uint8 = 0x0D
+
+// meiHandler is the handler of one MEI type of the Encapsulated Interface Transport.
+type meiHandler struct {
+	function func(*Server, Framer) ([]byte, *Exception)
+	length   RequestLength
+}
+
+// RegisterMEIHandler installs the handler for a MEI type of function 43 (Encapsulated Interface Transport).
+// The handler receives the whole request with the MEI type as the first data byte and has to return it
+// as the first byte of the response. The length rule is used to receive the requests as RTU frames over
+// streams without timing (ListenRTUOverTCP, ServeConn with FramingRTU) and to answer shorter requests
+// with IllegalDataValue, it may be nil if the MEI type is only used over other transports.
+func (s *Server) RegisterMEIHandler(meiType uint8, function func(*Server, Framer) ([]byte, *Exception), length RequestLength) {
+	s.mei[meiType] = meiHandler{function, length}
+}
+
+// EncapsulatedInterfaceTransport function 43, dispatches the request to the handler of its MEI type.
+func EncapsulatedInterfaceTransport(s *Server, frame Framer) ([]byte, *Exception) {
+	data := frame.GetData()
+	if len(data) < 1 {
+		return []byte{}, &IllegalDataValue
+	}
+	handler, ok := s.mei[data[0]]
+	if !ok {
+		return []byte{}, &IllegalFunction
+	}
+	return handler.function(s, frame)
+}
+
+// CANopenGeneralReference adapts a handler of CANopen General Reference requests to RegisterMEIHandler.
+// The handler is called with the request data following the MEI type and returns the response data
+// without the MEI type, e.g. to tunnel SDO requests to a CANopen network.
+func CANopenGeneralReference(handler func(s *Server, request []byte) ([]byte, *Exception)) func(*Server, Framer) ([]byte, *Exception) {
+	return func(s *Server, frame Framer) ([]byte, *Exception) {
+		response, exception := handler(s, frame.GetData()[1:])
+		if exception != &Success {
+			return []byte{}, exception
+		}
+		return append([]byte{CANopenGeneralReference_mei}, response...), exception
+	}
+}
+
+// getMEISizeFromHeader returns the size of a function 43 request PDU according to the length
+// rule of its MEI type.
+func (s *Server) getMEISizeFromHeader(header []byte) (int, error) {
+	if len(header) < 2 {
+		return max_PDU, nil
+	}
+	handler, ok := s.mei[header[1]]
+	if !ok || handler.length == nil {
+		return 0, errUnsupportedFunction
+	}
+	return handler.length(header)
+}
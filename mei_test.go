@@ -0,0 +1,66 @@
+package mbserver
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncapsulatedInterfaceTransport(t *testing.T) {
+	s, _ := NewServer(255)
+
+	s.RegisterMEIHandler(CANopenGeneralReference_mei,
+		CANopenGeneralReference(func(s *Server, request []byte) ([]byte, *Exception) {
+			return append([]byte{0xAA}, request...), &Success
+		}), ByteCountRequestLength(2))
+
+	var frame TCPFrame
+	frame.TransactionIdentifier = 1
+	frame.ProtocolIdentifier = 0
+	frame.Device = 255
+	frame.Function = ReadDeviceIdentification_fc
+	frame.SetData([]byte{CANopenGeneralReference_mei, 2, 1, 2})
+
+	var req Request
+	req.frame = &frame
+	response := s.handle(&req)
+	expect := []byte{CANopenGeneralReference_mei, 0xAA, 2, 1, 2}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	frame.SetData([]byte{ReadDeviceIdentification_mei, ReadDeviceIdBasic_code, 0})
+	response = s.handle(&req)
+	exception := GetException(response)
+	if exception != Success {
+		t.Errorf("Read Device Identification expected Success, got %v", exception.String())
+	}
+
+	frame.SetData([]byte{0x0F, 0})
+	response = s.handle(&req)
+	exception = GetException(response)
+	if exception != IllegalFunction {
+		t.Errorf("unknown MEI type expected IllegalFunction, got %v", exception.String())
+	}
+}
+
+func TestReadRequestsMEI(t *testing.T) {
+	s, _ := NewServer(255)
+	s.RegisterMEIHandler(CANopenGeneralReference_mei,
+		CANopenGeneralReference(func(s *Server, request []byte) ([]byte, *Exception) {
+			return request, &Success
+		}), ByteCountRequestLength(2))
+
+	for _, data := range [][]byte{
+		(&RTUFrame{Address: 255, Function: 43, Data: []byte{0x0E, 1, 0}}).Bytes(),
+		(&RTUFrame{Address: 255, Function: 43, Data: []byte{0x0D, 3, 1, 2, 3}}).Bytes(),
+	} {
+		req, _, err := s.readRTU(bytes.NewBuffer(data), new([]byte))
+		if err != nil {
+			t.Errorf("expected nil, got %v\n", err)
+		}
+		if !isEqual(data, req) {
+			t.Errorf("expected %v got %v\n", data, req)
+		}
+	}
+}
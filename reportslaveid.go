@@ -0,0 +1,56 @@
+package mbserver
+
+import (
+	"errors"
+	"sync"
+)
+
+// slaveIdentity holds the data returned by Report Slave ID, the run indicator
+// may be toggled by the application while the server is running.
+type slaveIdentity struct {
+	sync.Mutex
+	id             []byte
+	run            bool
+	additionalData []byte
+}
+
+// SetReportSlaveId sets the slave id and the additional device specific data returned by Report Slave ID.
+// By default the slave id is the Modbus Slave Id and there is no additional data.
+func (s *Server) SetReportSlaveId(id []byte, additionalData []byte) error {
+	// function code, byte count and run indicator status
+	if len(id)+len(additionalData)+3 > max_PDU {
+		return errors.New("Slave id and additional data do not fit into a Modbus PDU")
+	}
+
+	s.identity.Lock()
+	defer s.identity.Unlock()
+	s.identity.id = append([]byte{}, id...)
+	s.identity.additionalData = append([]byte{}, additionalData...)
+	return nil
+}
+
+// SetRunIndicator sets the run indicator status returned by Report Slave ID, the default is ON.
+func (s *Server) SetRunIndicator(on bool) {
+	s.identity.Lock()
+	s.identity.run = on
+	s.identity.Unlock()
+}
+
+// ReportSlaveId function 17, reports the slave id, the run indicator status and the
+// additional device specific data.
+func ReportSlaveId(s *Server, frame Framer) ([]byte, *Exception) {
+	s.identity.Lock()
+	defer s.identity.Unlock()
+
+	data := make([]byte, 1, 2+len(s.identity.id)+len(s.identity.additionalData))
+	data = append(data, s.identity.id...)
+	if s.identity.run {
+		data = append(data, 0xFF)
+	} else {
+		data = append(data, 0x00)
+	}
+	data = append(data, s.identity.additionalData...)
+	data[0] = byte(len(data) - 1)
+
+	return data, &Success
+}
@@ -0,0 +1,68 @@
+package mbserver
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReportSlaveId(t *testing.T) {
+	s, _ := NewServer(17)
+
+	var frame RTUFrame
+	frame.Address = 17
+	frame.Function = ReportSlaveId_fc
+
+	var req Request
+	req.frame = &frame
+	response := s.handle(&req)
+	expect := []byte{17, 17, 2, 17, 0xFF}
+	got := response.Bytes()[:5]
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	s.SetReportSlaveId([]byte{1, 2}, []byte("v1"))
+	s.SetRunIndicator(false)
+	response = s.handle(&req)
+	expect = []byte{5, 1, 2, 0x00, 'v', '1'}
+	got = response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	if err := s.SetReportSlaveId(make([]byte, 200), make([]byte, 51)); err == nil {
+		t.Errorf("expected error for oversized slave id, got nil")
+	}
+}
+
+func TestReportSlaveIdOverTCP(t *testing.T) {
+	s, _ := NewServer(17)
+	defer s.Close()
+
+	err := s.ListenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	conn, err := net.Dial("tcp", s.listeners[0].Addr().String())
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	defer conn.Close()
+
+	// The request has no data, its ADU is the MBAP header and the function code.
+	conn.Write([]byte{0, 1, 0, 0, 0, 2, 17, ReportSlaveId_fc})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	packet, err := readTCP(conn)
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	response, err := NewTCPFrame(packet)
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	expect := []byte{2, 17, 0xFF}
+	if response.Function != ReportSlaveId_fc || !isEqual(expect, response.Data) {
+		t.Errorf("expected %v, got %v %v", expect, response.Function, response.Data)
+	}
+}
@@ -0,0 +1,142 @@
+package mbserver
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var errFramingError = errors.New("RTU request interrupted by a silent interval longer than 1.5 characters")
+
+// rtuFramer delimits the RTU requests received on a connection.
+type rtuFramer interface {
+	// readFrame returns the next request, a serial timeout is returned while the line is idle.
+	readFrame() ([]byte, error)
+	// badFrame is called with a request which failed the CRC check.
+	badFrame(request []byte)
+}
+
+// streamRTUFramer determines the end of a request from its function code, it is used for streams
+// without timing like RTU over TCP.
+type streamRTUFramer struct {
+	s      *Server
+	reader io.Reader
+	last   []byte //bytes read after the previous request
+}
+
+func (f *streamRTUFramer) readFrame() ([]byte, error) {
+	request, _, err := f.s.readRTU(f.reader, &f.last)
+	if isTimeout(err) {
+		f.last = f.last[:0]
+	}
+	return request, err
+}
+
+func (f *streamRTUFramer) badFrame(request []byte) {
+	// The bytes of the request after its address are searched for the start of the next one.
+	if next := f.s.resync(request[1:]); next != nil {
+		f.last = append(append([]byte{}, next...), f.last...)
+	}
+}
+
+// silenceRTUFramer delimits requests on a serial line by the silent interval of 3.5 characters
+// which has to precede and follow every request. A silence of more than 1.5 characters within a
+// request is a framing error and the request is discarded.
+type silenceRTUFramer struct {
+	reader io.Reader
+	char   time.Duration    //transmission time of one character
+	t15    time.Duration    //longest silence allowed within a request
+	t35    time.Duration    //shortest silence between requests
+	now    func() time.Time //injected for tests
+	frame  []byte           //the request being received
+	err    error            //framing error or overrun of the request being received
+	last   time.Time        //when the last character was received
+}
+
+// newSilenceRTUFramer returns a framer for a serial port read with a timeout of t3.5 (see rtuTimings).
+func newSilenceRTUFramer(reader io.Reader, baudRate int) *silenceRTUFramer {
+	char, t15, t35 := rtuTimings(baudRate)
+	return &silenceRTUFramer{reader: reader, char: char, t15: t15, t35: t35, now: time.Now}
+}
+
+// rtuTimings returns the transmission time of a character of 11 bits and the t1.5 and t3.5 intervals
+// at the baud rate. Above 19200 baud fixed intervals of 750µs and 1.75ms are used.
+func rtuTimings(baudRate int) (char, t15, t35 time.Duration) {
+	if baudRate <= 0 {
+		baudRate = 19200 // the default of goburrow/serial
+	}
+	char = 11 * time.Second / time.Duration(baudRate)
+	if baudRate > 19200 {
+		return char, 750 * time.Microsecond, 1750 * time.Microsecond
+	}
+	return char, char * 3 / 2, char * 7 / 2
+}
+
+func (f *silenceRTUFramer) readFrame() ([]byte, error) {
+	buf := make([]byte, max_ADU_RTU+1)
+	for {
+		n, err := f.reader.Read(buf)
+		now := f.now()
+		if n == 0 && err == nil {
+			// A serial port signals a hang up, e.g. of an unplugged adapter, by reading nothing.
+			err = io.EOF
+		}
+
+		if n > 0 {
+			// The silence before the first of the n characters.
+			silence := now.Sub(f.last) - time.Duration(n)*f.char
+			f.last = now
+
+			if f.receiving() && silence >= f.t35 {
+				// The characters start the next request.
+				request, err := f.complete()
+				f.add(buf[:n])
+				return request, err
+			}
+			if f.receiving() && silence > f.t15 {
+				f.err = errFramingError
+			}
+			f.add(buf[:n])
+		}
+
+		if err != nil {
+			// A read timeout of t3.5 or the end of the stream ends the request.
+			if (isTimeout(err) || err == io.EOF) && f.receiving() {
+				return f.complete()
+			}
+			return nil, err
+		}
+	}
+}
+
+func (f *silenceRTUFramer) badFrame(request []byte) {
+	// The whole request is discarded, the next one starts after a silence.
+}
+
+// receiving reports whether characters of a request have been received since the last silence.
+func (f *silenceRTUFramer) receiving() bool {
+	return len(f.frame) > 0 || f.err != nil
+}
+
+// add appends the characters to the request, the request is discarded if it exceeds max_ADU_RTU.
+func (f *silenceRTUFramer) add(characters []byte) {
+	if f.err == errCharacterOverrun {
+		return
+	}
+	if len(f.frame)+len(characters) > max_ADU_RTU {
+		f.err = errCharacterOverrun
+		f.frame = f.frame[:0]
+		return
+	}
+	f.frame = append(f.frame, characters...)
+}
+
+// complete returns the received request and starts the next one.
+func (f *silenceRTUFramer) complete() ([]byte, error) {
+	request, err := f.frame, f.err
+	f.frame, f.err = nil, nil
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
@@ -0,0 +1,121 @@
+package mbserver
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+// timedRead is the result of one Read of a timedReader, the clock is advanced by delay before it returns.
+type timedRead struct {
+	delay time.Duration
+	data  []byte
+	err   error
+}
+
+// timedReader replays reads of a serial port on a fake clock.
+type timedReader struct {
+	clock time.Time
+	reads []timedRead
+}
+
+func (r *timedReader) Read(p []byte) (int, error) {
+	if len(r.reads) == 0 {
+		return 0, io.EOF
+	}
+	read := r.reads[0]
+	r.reads = r.reads[1:]
+	r.clock = r.clock.Add(read.delay)
+	return copy(p, read.data), read.err
+}
+
+func (r *timedReader) now() time.Time {
+	return r.clock
+}
+
+func newTestSilenceFramer(reads ...timedRead) *silenceRTUFramer {
+	reader := &timedReader{clock: time.Unix(0, 0), reads: reads}
+	f := newSilenceRTUFramer(reader, 9600)
+	f.now = reader.now
+	return f
+}
+
+func TestRTUTimings(t *testing.T) {
+	char, t15, t35 := rtuTimings(9600)
+	if char != 1145833*time.Nanosecond || t15 != char*3/2 || t35 != char*7/2 {
+		t.Errorf("unexpected timings %v %v %v at 9600 baud", char, t15, t35)
+	}
+
+	_, t15, t35 = rtuTimings(115200)
+	if t15 != 750*time.Microsecond || t35 != 1750*time.Microsecond {
+		t.Errorf("unexpected timings %v %v at 115200 baud", t15, t35)
+	}
+}
+
+func TestSilenceRTUFramer(t *testing.T) {
+	char := 1145833 * time.Nanosecond
+
+	// An unknown function code split over two reads, followed by a second request after a silence
+	// of 4 characters and a read timeout. The delay of a read includes the transmission of its data.
+	f := newTestSilenceFramer(
+		timedRead{delay: time.Second, data: []byte{1, 99, 1}},
+		timedRead{delay: 2 * char, data: []byte{2, 3}},
+		timedRead{delay: 8 * char, data: []byte{1, 3, 0, 0}},
+		timedRead{delay: 3 * char, data: []byte{0, 1}},
+		timedRead{delay: 4 * char, err: serial.ErrTimeout},
+	)
+
+	request, err := f.readFrame()
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	expect := []byte{1, 99, 1, 2, 3}
+	if !isEqual(expect, request) {
+		t.Errorf("expected %v, got %v", expect, request)
+	}
+
+	request, err = f.readFrame()
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	expect = []byte{1, 3, 0, 0, 0, 1}
+	if !isEqual(expect, request) {
+		t.Errorf("expected %v, got %v", expect, request)
+	}
+
+	_, err = f.readFrame()
+	if err != io.EOF {
+		t.Errorf("expected %v, got %v", io.EOF, err)
+	}
+}
+
+func TestSilenceRTUFramerErrors(t *testing.T) {
+	char := 1145833 * time.Nanosecond
+
+	// A silence of 2 characters within the first request, the second request is too long.
+	f := newTestSilenceFramer(
+		timedRead{delay: time.Second, data: []byte{1, 3}},
+		timedRead{delay: 4 * char, data: []byte{0, 0}},
+		timedRead{delay: 4 * char, err: serial.ErrTimeout},
+		timedRead{delay: time.Second, data: make([]byte, 200)},
+		timedRead{delay: 100 * char, data: make([]byte, 100)},
+		timedRead{delay: 4 * char, err: serial.ErrTimeout},
+	)
+
+	_, err := f.readFrame()
+	if err != errFramingError {
+		t.Errorf("expected %v, got %v", errFramingError, err)
+	}
+
+	_, err = f.readFrame()
+	if err != errCharacterOverrun {
+		t.Errorf("expected %v, got %v", errCharacterOverrun, err)
+	}
+
+	_, err = f.readFrame()
+	if err != io.EOF {
+		t.Errorf("expected %v, got %v", io.EOF, err)
+	}
+}
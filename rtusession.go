@@ -0,0 +1,98 @@
+package mbserver
+
+import (
+	"io"
+	"sync"
+
+	"github.com/goburrow/serial"
+)
+
+// PortStats are the counters of a serial port served with ListenRTU.
+type PortStats struct {
+	Frames        uint64 // requests received with a valid CRC, including those to foreign addresses
+	CRCErrors     uint64 // requests with a wrong CRC or less than 4 bytes
+	ForeignFrames uint64 // requests to addresses not served by the server
+	Timeouts      uint64 // requests discarded because of a silence of more than 1.5 characters within them
+	Overruns      uint64 // requests discarded because they exceed 256 bytes
+	BytesIn       uint64
+	BytesOut      uint64
+}
+
+// rtuSession is the state of a connection on which RTU requests are received: its receive
+// buffer and framing state are kept by the framer. It counts the bytes read and written
+// through it, responses are written to the session.
+type rtuSession struct {
+	conn   io.ReadWriteCloser //replaced when a lost serial port is opened again
+	config serial.Config      //zero for connections which are no serial port
+	framer rtuFramer
+	mu     sync.Mutex
+	stats  PortStats
+}
+
+// newSerialSession returns the session of a serial port opened with config.
+func newSerialSession(port io.ReadWriteCloser, config serial.Config) *rtuSession {
+	session := &rtuSession{conn: port, config: config}
+	session.framer = newSilenceRTUFramer(session, config.BaudRate)
+	return session
+}
+
+// newStreamSession returns the session of a connection without timing.
+func (s *Server) newStreamSession(conn io.ReadWriteCloser) *rtuSession {
+	session := &rtuSession{conn: conn}
+	session.framer = &streamRTUFramer{s: s, reader: session}
+	return session
+}
+
+// setPort replaces the serial port of the session after it was opened again, the framing starts anew.
+func (p *rtuSession) setPort(port io.ReadWriteCloser) {
+	p.mu.Lock()
+	p.conn = port
+	p.mu.Unlock()
+	p.framer = newSilenceRTUFramer(p, p.config.BaudRate)
+}
+
+func (p *rtuSession) port() io.ReadWriteCloser {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.conn
+}
+
+func (p *rtuSession) Read(b []byte) (int, error) {
+	n, err := p.port().Read(b)
+	p.add(&p.stats.BytesIn, n)
+	return n, err
+}
+
+func (p *rtuSession) Write(b []byte) (int, error) {
+	n, err := p.port().Write(b)
+	p.add(&p.stats.BytesOut, n)
+	return n, err
+}
+
+func (p *rtuSession) Close() error {
+	return p.port().Close()
+}
+
+func (p *rtuSession) inc(counter *uint64) {
+	p.add(counter, 1)
+}
+
+func (p *rtuSession) add(counter *uint64, n int) {
+	p.mu.Lock()
+	*counter += uint64(n)
+	p.mu.Unlock()
+}
+
+// PortStats returns the counters of the serial port opened by ListenRTU with the address (e.g. "/dev/ttyUSB0"),
+// false if the server does not listen on the port.
+func (s *Server) PortStats(address string) (PortStats, bool) {
+	s.sessionsMu.Lock()
+	session, ok := s.sessions[address]
+	s.sessionsMu.Unlock()
+	if !ok {
+		return PortStats{}, false
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.stats, true
+}
@@ -0,0 +1,97 @@
+package mbserver
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+// testPort is a serial port replaying timed reads which discards the responses.
+type testPort struct {
+	timedReader
+}
+
+func (p *testPort) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (p *testPort) Close() error {
+	return nil
+}
+
+func TestPortStats(t *testing.T) {
+	s, _ := NewServer(1)
+	s.HoldingRegisters = make([]byte, 20)
+	defer s.Close()
+
+	request := func(address uint8) []byte {
+		return (&RTUFrame{Address: address, Function: 3, Data: []byte{0, 1, 0, 1}}).Bytes()
+	}
+	badCRC := request(1)
+	badCRC[7]++
+
+	port := &testPort{timedReader{clock: time.Unix(0, 0), reads: []timedRead{
+		{delay: time.Second, data: request(1)},
+		{delay: 10 * time.Millisecond, err: serial.ErrTimeout},
+		{delay: time.Second, data: request(7)},
+		{delay: 10 * time.Millisecond, err: serial.ErrTimeout},
+		{delay: time.Second, data: badCRC},
+		{delay: 10 * time.Millisecond, err: serial.ErrTimeout},
+	}}}
+
+	session := newSerialSession(port, serial.Config{Address: "/dev/test", BaudRate: 9600})
+	session.framer.(*silenceRTUFramer).now = port.now
+	s.sessions["/dev/test"] = session
+
+	if err := s.acceptRTURequests(session); err != io.EOF {
+		t.Errorf("expected %v, got %v", io.EOF, err)
+	}
+
+	stats, ok := s.PortStats("/dev/test")
+	if !ok {
+		t.Fatalf("expected stats of /dev/test")
+	}
+	expect := PortStats{Frames: 2, CRCErrors: 1, ForeignFrames: 1, BytesIn: 24}
+	stats.BytesOut = 0 // the response may not be written yet
+	if !isEqual(expect, stats) {
+		t.Errorf("expected %+v, got %+v", expect, stats)
+	}
+
+	if _, ok := s.PortStats("/dev/other"); ok {
+		t.Errorf("expected no stats of /dev/other")
+	}
+}
+
+func TestPortStatsWhileListening(t *testing.T) {
+	s, _ := NewServer(1)
+	s.SerialOpener = SerialOpenerFunc(func(config *serial.Config) (SerialPort, error) {
+		_, port := net.Pipe()
+		return port, nil
+	})
+
+	// Ports are opened and their stats read concurrently.
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func(address string) {
+			defer func() { done <- struct{}{} }()
+			if err := s.ListenRTU(&serial.Config{Address: address}); err != nil {
+				t.Errorf("expected nil, got %v\n", err)
+			}
+		}(fmt.Sprintf("/dev/test%d", i))
+	}
+	for i := 0; i < 4; i++ {
+		s.PortStats(fmt.Sprintf("/dev/test%d", i))
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+	s.Close()
+
+	if _, ok := s.PortStats("/dev/test3"); !ok {
+		t.Errorf("expected stats of /dev/test3")
+	}
+}
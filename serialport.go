@@ -0,0 +1,51 @@
+package mbserver
+
+import (
+	"errors"
+	"io"
+
+	"github.com/goburrow/serial"
+)
+
+// SerialPort is a serial port served by ListenRTU or ListenASCII. If no data is received within
+// the Timeout of the serial.Config the port was opened with, Read returns serial.ErrTimeout or
+// an error with a Timeout method which returns true.
+type SerialPort interface {
+	io.ReadWriteCloser
+}
+
+// SerialOpener opens the serial ports of a Server, see Server.SerialOpener.
+type SerialOpener interface {
+	Open(config *serial.Config) (SerialPort, error)
+}
+
+// SerialOpenerFunc adapts a function to a SerialOpener.
+type SerialOpenerFunc func(config *serial.Config) (SerialPort, error)
+
+// Open calls f(config).
+func (f SerialOpenerFunc) Open(config *serial.Config) (SerialPort, error) {
+	return f(config)
+}
+
+// DefaultSerialOpener opens serial ports with github.com/goburrow/serial, it is used if
+// Server.SerialOpener is nil.
+var DefaultSerialOpener SerialOpener = SerialOpenerFunc(func(config *serial.Config) (SerialPort, error) {
+	return serial.Open(config)
+})
+
+// openSerialPort opens a serial port with the opener of the server.
+func (s *Server) openSerialPort(config *serial.Config) (SerialPort, error) {
+	if s.SerialOpener != nil {
+		return s.SerialOpener.Open(config)
+	}
+	return DefaultSerialOpener.Open(config)
+}
+
+// isTimeout reports whether err is the read timeout of a serial port.
+func isTimeout(err error) bool {
+	if err == serial.ErrTimeout {
+		return true
+	}
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
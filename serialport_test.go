@@ -0,0 +1,51 @@
+package mbserver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+func TestIsTimeout(t *testing.T) {
+	for err, expect := range map[error]bool{
+		serial.ErrTimeout:      true,
+		os.ErrDeadlineExceeded: true,
+		io.EOF:                 false,
+	} {
+		if got := isTimeout(err); got != expect {
+			t.Errorf("isTimeout(%v): expected %v, got %v", err, expect, got)
+		}
+	}
+}
+
+func TestSerialOpener(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	s, _ := NewServer(0x11)
+	s.HoldingRegisters = make([]byte, 0x100*2)
+	s.SerialOpener = SerialOpenerFunc(func(config *serial.Config) (SerialPort, error) {
+		return server, nil
+	})
+	defer s.Close()
+
+	if err := s.ListenASCII(&serial.Config{Address: "mock"}); err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+
+	client.SetDeadline(time.Now().Add(time.Second))
+	go client.Write([]byte(":1103006B00027F\r\n"))
+	response, err := bufio.NewReader(client).ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	expect := ":11030400000000E8\r\n"
+	if string(response) != expect {
+		t.Errorf("expected %q, got %q", expect, response)
+	}
+}
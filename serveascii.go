@@ -0,0 +1,108 @@
+package mbserver
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+// ListenASCII starts the Modbus ASCII server on a serial port. Unlike a port served with ListenRTU
+// it has no PortStats and is not opened again if reading it fails.
+func (s *Server) ListenASCII(serialConfig *serial.Config) (err error) {
+	if s.isUnit() {
+		return errUnitListen
+	}
+	port, err := s.openSerialPort(serialConfig)
+	if err != nil {
+		log.Printf("failed to open %s: %v\n", serialConfig.Address, err)
+		return err
+	}
+	s.ports = append(s.ports, port)
+	go func() {
+		if err := s.ServeConn(port, FramingASCII); err != nil {
+			log.Printf("read error on %s: %v\n", serialConfig.Address, err)
+		}
+	}()
+	return err
+}
+
+// ListenASCIIOverTCP starts the Modbus ASCII server listening on "address:port".
+// Every TCP connection carries a stream of ASCII frames like a serial line.
+func (s *Server) ListenASCIIOverTCP(addressPort string) (err error) {
+	if s.isUnit() {
+		return errUnitListen
+	}
+	listen, err := net.Listen("tcp", addressPort)
+	if err != nil {
+		log.Printf("Failed to Listen: %v\n", err)
+		return err
+	}
+	s.listeners = append(s.listeners, listen)
+	go s.acceptConns(listen, func(conn net.Conn) error {
+		return s.ServeConn(conn, FramingASCII)
+	})
+	return err
+}
+
+// acceptASCIIRequests reads ASCII frames from conn until the server is closed (nil is returned) or
+// reading fails. A frame starts with ':' and ends with CR LF, a ':' in the middle of a frame discards
+// the characters before it. A frame exceeding max_ADU_ASCII is discarded up to the next ':'.
+func (s *Server) acceptASCIIRequests(conn io.ReadWriteCloser) error {
+	reader := bufio.NewReader(conn)
+	packet := make([]byte, 0, max_ADU_ASCII)
+
+	for {
+		select {
+		case <-s.closeChan:
+			return nil
+		default:
+			c, err := reader.ReadByte()
+			if err != nil {
+				if isTimeout(err) {
+					continue // the rest of the frame may still follow
+				}
+				return err
+			}
+
+			if c == asciiStart {
+				packet = append(packet[:0], c)
+				continue
+			}
+			if len(packet) == 0 {
+				continue // no start of a frame, discard the character
+			}
+			if len(packet) == max_ADU_ASCII {
+				s.busError(receiveOverrun)
+				packet = packet[:0]
+				continue
+			}
+			packet = append(packet, c)
+			if c != '\n' {
+				continue
+			}
+
+			t := time.Now()
+			request := packet
+			packet = packet[:0]
+
+			s.busMessage()
+
+			frame, err := NewASCIIFrame(request)
+			if err != nil {
+				s.busError(receiveCommError)
+				log.Printf("bad ascii frame error %v\n", err)
+				continue
+			}
+
+			if !s.acceptsAddress(frame.Address) {
+				continue
+			}
+
+			s.send(&Request{conn: conn, frame: frame, t: t, unitId: frame.Address, broadcast: frame.Address == 0})
+		}
+	}
+}
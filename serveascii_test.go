@@ -0,0 +1,62 @@
+package mbserver
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestAcceptASCIIRequests(t *testing.T) {
+	s, _ := NewServer(0x11)
+	s.HoldingRegisters = make([]byte, 0x100*2)
+	s.HoldingRegisters[0x6B*2+1] = 7
+	defer s.Close()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.ServeConn(server, FramingASCII)
+
+	// The characters before the last ':' are discarded.
+	go client.Write([]byte("noise:11:1103006B00027F\r\n"))
+
+	response, err := bufio.NewReader(client).ReadBytes('\n')
+	if !isEqual(nil, err) {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+
+	frame, err := NewASCIIFrame(response)
+	if !isEqual(nil, err) {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+
+	expect := []byte{4, 0, 7, 0, 0}
+	if !isEqual(expect, frame.Data) {
+		t.Errorf("expected %v, got %v", expect, frame.Data)
+	}
+}
+
+func TestAcceptASCIIRequestsOverrun(t *testing.T) {
+	s, _ := NewServer(0x11)
+	s.HoldingRegisters = make([]byte, 0x100*2)
+	s.HoldingRegisters[0x6B*2+1] = 7
+	defer s.Close()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.ServeConn(server, FramingASCII)
+
+	// A frame without an end is discarded once it exceeds the maximum size.
+	go client.Write(append(append([]byte{':'}, bytes.Repeat([]byte{'A'}, 4000)...), ":1103006B00027F\r\n"...))
+
+	response, err := bufio.NewReader(client).ReadBytes('\n')
+	if !isEqual(nil, err) {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if expect := ":11030400070000E1\r\n"; string(response) != expect {
+		t.Errorf("expected %q, got %q", expect, response)
+	}
+	if s.diag.charOverruns != 1 {
+		t.Errorf("expected 1 character overrun, got %v", s.diag.charOverruns)
+	}
+}
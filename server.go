@@ -1,12 +1,12 @@
 package mbserver
 
 import (
+	"encoding/binary"
 	"errors"
 	"io"
 	"net"
+	"sync"
 	"time"
-
-	"github.com/goburrow/serial"
 )
 
 // Server is a Modbus slave with allocated memory for discrete inputs, coils, etc.
@@ -15,32 +15,87 @@ type Server struct {
 	Debug            bool
 	slaveId          uint8
 	listeners        []net.Listener
-	ports            []serial.Port
+	ports            []SerialPort
+	packetConns      []net.PacketConn
 	requestChan      chan *Request
+	requestMu        sync.RWMutex //read locked while a request is sent to requestChan
+	requestsClosed   bool         //requestChan has been closed, guarded by requestMu
 	function         map[uint8]func(*Server, Framer) ([]byte, *Exception)
 	DiscreteInputs   []byte
 	Coils            []byte
 	HoldingRegisters []byte
 	InputRegisters   []byte
-	last             []byte //buffer if there has been read more than one request buffer for new bytes so they do not get lost
 	outChan          chan string
 	closeChan        chan struct{} //channel to close all go-Routines if the server is no more used/closed
+	closeOnce        sync.Once     //closes closeChan
+	diag             *diagnostics
+	events           *commEvents
+	exceptionStatus  [8]exceptionStatus
+	identity         slaveIdentity
+	fifos            map[uint16]*FifoQueue
+	requestLength    map[uint8]RequestLength
+	mei              map[uint8]meiHandler
+	units            map[uint8]*Server      //virtual devices served in addition to this one
+	root             *Server                //the Server a unit was added to, nil for it
+	sessions         map[string]*rtuSession //serial ports served with ListenRTU by address
+	sessionsMu       sync.Mutex             //guards sessions
+	conns            map[io.Closer]struct{} //connections being served, closed by Close
+	connsMu          sync.Mutex             //guards conns
+
+	// StrictConformance checks every request against the exception state diagrams of the
+	// Modbus specification before it is handled.
+	StrictConformance bool
+	// TCPBroadcast executes write requests to unit id 0 received over TCP as broadcast requests
+	// without a response. Serial requests to address 0 are always broadcast requests.
+	TCPBroadcast bool
+	// Files holds the files accessed by Read File Record and Write File Record, the
+	// functions are not supported if it is nil.
+	Files FileStore
+	// DeviceIdentification holds the objects returned by Read Device Identification, keyed by object id.
+	DeviceIdentification map[uint8][]byte
+	// SerialOpener opens the serial ports of ListenRTU and ListenASCII, e.g. to use another serial
+	// library or a mock port in tests. DefaultSerialOpener is used if it is nil.
+	SerialOpener SerialOpener
+	// PortStateChanged is called when a serial port served with ListenRTU is connected, lost or
+	// reopened. The error is the read error of a lost port, nil otherwise.
+	PortStateChanged func(address string, state PortState, err error)
+	// Authorize is called for every request received with ListenTLS, denied requests are answered
+	// with IllegalFunction. All requests are allowed if it is nil. It also decides on the requests
+	// to the units of the Server, the Authorize of a unit is not used.
+	Authorize Authorizer
 }
 
 type Request struct {
-	conn  io.ReadWriteCloser
-	frame Framer
-	t     time.Time //add time so we can log it as well
+	conn      io.ReadWriteCloser
+	frame     Framer
+	t         time.Time //add time so we can log it as well
+	unitId    uint8     //serial address or TCP unit id the request is sent to
+	broadcast bool      //request to address 0, it is never answered
+	role      *string   //Modbus/TCP Security role of the client, nil for requests not received over TLS
 }
 
 //could improve the constructor to make it clearer to use
 func NewServer(id uint8) (*Server, error) {
-	s := &Server{}
-
 	if id == 0 {
 		return nil, errors.New("Modbus Slave Id must not be set to 0")
 	}
 
+	s := newServer(id)
+	s.units = make(map[uint8]*Server)
+	s.conns = make(map[io.Closer]struct{})
+
+	s.requestChan = make(chan *Request)
+	s.closeChan = make(chan struct{})
+	go s.handler()
+
+	return s, nil
+}
+
+// newServer allocates a server with the default function handlers, it is used for the
+// Server returned by NewServer and for its units.
+func newServer(id uint8) *Server {
+	s := &Server{}
+
 	s.slaveId = id
 	// Allocate Modbus memory maps.
 	//s.DiscreteInputs = make([]byte, numberDiscreteInputs) //memory usage could be minimized
@@ -58,11 +113,30 @@ func NewServer(id uint8) (*Server, error) {
 	s.function[WriteHoldingRegister_fc] = WriteHoldingRegister
 	s.function[WriteMultipleCoils_fc] = WriteMultipleCoils
 	s.function[WriteHoldingRegisters_fc] = WriteHoldingRegisters
+	s.function[MaskWriteRegister_fc] = MaskWriteRegister
+	s.function[ReadWriteMultipleRegisters_fc] = ReadWriteMultipleRegisters
+	s.function[ReadFifoQueue_fc] = ReadFifoQueue
+	s.function[ReadExceptionStatus_fc] = ReadExceptionStatus
+	s.function[Diagnostics_fc] = Diagnostics
+	s.function[GetCommEventCounter_fc] = GetCommEventCounter
+	s.function[GetCommEventLog_fc] = GetCommEventLog
+	s.function[ReportSlaveId_fc] = ReportSlaveId
+	s.function[ReadFileRecord_fc] = ReadFileRecord
+	s.function[WriteFileRecord_fc] = WriteFileRecord
+	s.function[ReadDeviceIdentification_fc] = EncapsulatedInterfaceTransport
 
-	s.requestChan = make(chan *Request)
-	go s.handler()
+	s.DeviceIdentification = make(map[uint8][]byte)
+	s.fifos = make(map[uint16]*FifoQueue)
+	s.sessions = make(map[string]*rtuSession)
+	s.requestLength = make(map[uint8]RequestLength)
+	s.mei = make(map[uint8]meiHandler)
+	s.mei[ReadDeviceIdentification_mei] = meiHandler{ReadDeviceIdentification, FixedRequestLength(4)}
+	s.diag = &diagnostics{}
+	s.events = &commEvents{}
+	s.identity.id = []byte{id}
+	s.identity.run = true
 
-	return s, nil
+	return s
 }
 
 // RegisterFunctionHandler override the default behavior for a given Modbus function.
@@ -70,27 +144,103 @@ func (s *Server) RegisterFunctionHandler(funcCode uint8, function func(*Server,
 	s.function[funcCode] = function
 }
 
+// RegisterFunctionHandlerWithLength registers a handler like RegisterFunctionHandler together with
+// the rule which determines the length of its requests. RTU requests on streams without timing
+// (ListenRTUOverTCP, ServeConn with FramingRTU) of function codes unknown to the library can only be
+// received if such a rule is registered, ListenRTU delimits requests by silence and needs none.
+// Requests shorter than the rule requires are answered with IllegalDataValue on every transport.
+func (s *Server) RegisterFunctionHandlerWithLength(funcCode uint8, function func(*Server, Framer) ([]byte, *Exception), length RequestLength) {
+	s.function[funcCode] = function
+	s.requestLength[funcCode] = length
+}
+
+// handle executes the request and returns the response frame.
+// No response (nil) is returned while the server is in listen only mode.
 func (s *Server) handle(request *Request) Framer {
 	var exception *Exception
 	var data []byte
 
+	s.diag.inc(&s.diag.serverMessages)
+
 	response := request.frame.Copy()
 
 	function := request.frame.GetFunction()
-	if _, ok := s.function[function]; ok {
-		data, exception = s.function[function](s, request.frame)
-		response.SetData(data)
+
+	if request.broadcast {
+		s.logReceiveEvent(receiveBroadcast)
+		if !isBroadcastFunction(function) {
+			// Reads can not be answered, the request is rejected without being executed.
+			s.diag.inc(&s.diag.serverNoResponses)
+			return nil
+		}
 	} else {
+		s.logReceiveEvent(0)
+	}
+
+	listenOnly := s.diag.isListenOnly()
+	if listenOnly && !isRestartCommunications(request.frame) {
+		s.diag.inc(&s.diag.serverNoResponses)
+		s.logSendEvent(&Success)
+		return nil
+	}
+
+	if _, ok := s.function[function]; !ok {
 		exception = &IllegalFunction
+	} else if !s.authorized(request) {
+		exception = &IllegalFunction
+	} else if s.truncated(request.frame) {
+		exception = &IllegalDataValue
+	} else if exception = s.checkRequest(request.frame); exception == &Success {
+		data, exception = s.function[function](s, request.frame)
+		response.SetData(data)
+	}
+
+	// Fetching the event counter or log does not count as a completed request.
+	if exception == &Success && function != GetCommEventCounter_fc && function != GetCommEventLog_fc {
+		s.events.count()
+	}
+	s.logSendEvent(exception)
+
+	if listenOnly || request.broadcast || s.diag.isListenOnly() {
+		s.diag.inc(&s.diag.serverNoResponses)
+		return nil
 	}
 
 	if exception != &Success {
 		response.SetException(exception)
+		s.diag.countException(exception)
 	}
 
 	return response
 }
 
+// truncated reports whether the request is shorter than its function code requires. The length of a
+// TCP or UDP request is taken from the MBAP header, so the handlers can not rely on the framing.
+func (s *Server) truncated(frame Framer) bool {
+	pdu := append([]byte{frame.GetFunction()}, frame.GetData()...)
+	size, err := s.getPDUSizeFromHeader(pdu)
+	return err == nil && len(pdu) < size
+}
+
+// isBroadcastFunction reports whether requests of the function may be broadcast,
+// which is true for the write functions.
+func isBroadcastFunction(function uint8) bool {
+	switch function {
+	case WriteSingleCoil_fc, WriteHoldingRegister_fc, WriteMultipleCoils_fc, WriteHoldingRegisters_fc,
+		WriteFileRecord_fc, MaskWriteRegister_fc:
+		return true
+	}
+	return false
+}
+
+// isRestartCommunications reports whether frame is the only request which is
+// processed in listen only mode.
+func isRestartCommunications(frame Framer) bool {
+	data := frame.GetData()
+	return frame.GetFunction() == Diagnostics_fc && len(data) >= 2 &&
+		binary.BigEndian.Uint16(data[0:2]) == RestartCommunicationsOption_sub
+}
+
 // All requests are handled synchronously to prevent modbus memory corruption.
 func (s *Server) handler() {
 	for {
@@ -103,29 +253,140 @@ func (s *Server) handler() {
 				default: // just to make sure that this channel won't block the server
 				}
 			}
-			response := s.handle(request)
-			request.conn.Write(response.Bytes())
+			response := s.route(request)
+			if response != nil {
+				request.conn.Write(response.Bytes())
+			}
 		} else {
-			close(s.outChan)
+			if s.outChan != nil {
+				close(s.outChan)
+			}
 			return
 		}
 
 	}
 }
 
-// Close stops listening to TCP/IP ports and closes serial ports.
+// send passes a request to the handler, it is dropped once the server has been closed.
+func (s *Server) send(request *Request) {
+	s.requestMu.RLock()
+	defer s.requestMu.RUnlock()
+	if !s.closed() {
+		s.requestChan <- request
+	}
+}
+
+// Framing selects how requests are delimited on a connection served with ServeConn.
+type Framing int
+
+const (
+	// FramingTCP reads requests with the MBAP header of Modbus TCP.
+	FramingTCP Framing = iota
+	// FramingRTU reads RTU frames with address and CRC, the end of a request is determined
+	// from its function code as streams carry no timing.
+	FramingRTU
+	// FramingASCII reads ASCII frames starting with ':' and ending with CR LF.
+	FramingASCII
+)
+
+// ServeConn serves the requests read from conn until it is closed or the server is closed and closes
+// conn when it returns, e.g. to serve a net.Pipe, an SSH channel or a serial port opened by the caller.
+// The responses are written to conn with the same framing as the requests. Close closes conn, which
+// ends a blocked read, nil is returned then.
+func (s *Server) ServeConn(conn io.ReadWriteCloser, framing Framing) error {
+	if s.isUnit() {
+		return errUnitListen
+	}
+	defer conn.Close()
+	if !s.track(conn) {
+		return nil
+	}
+	defer s.untrack(conn)
+
+	var err error
+	switch framing {
+	case FramingTCP:
+		err = s.serveTCPConn(conn, nil)
+	case FramingRTU:
+		err = s.acceptRTURequests(s.newStreamSession(conn))
+	case FramingASCII:
+		err = s.acceptASCIIRequests(conn)
+	default:
+		return errors.New("Unknown framing")
+	}
+
+	if err == io.EOF || s.closed() {
+		return nil
+	}
+	return err
+}
+
+// track adds conn to the connections closed by Close, false is returned if the server has been closed.
+func (s *Server) track(conn io.Closer) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.closed() {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(conn io.Closer) {
+	s.connsMu.Lock()
+	delete(s.conns, conn)
+	s.connsMu.Unlock()
+}
+
+// Close stops listening to TCP/IP ports and closes serial ports and the connections being served.
 func (s *Server) Close() {
+	if s.isUnit() {
+		return // units are closed with the Server they were added to
+	}
 
-	s.closeChan = make(chan struct{})
-	close(s.closeChan)
+	s.closeOnce.Do(func() {
+		close(s.closeChan)
+	})
 	for _, listen := range s.listeners {
 		listen.Close()
 	}
 	for _, port := range s.ports {
 		port.Close()
 	}
+	s.sessionsMu.Lock()
+	for _, session := range s.sessions {
+		session.Close()
+	}
+	s.sessionsMu.Unlock()
+	for _, conn := range s.packetConns {
+		conn.Close()
+	}
+	s.connsMu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsMu.Unlock()
+
+	// The handler returns after the requests being sent have been handled.
+	s.requestMu.Lock()
+	if !s.requestsClosed {
+		close(s.requestChan)
+		s.requestsClosed = true
+	}
+	s.requestMu.Unlock()
+}
+
+// closed reports whether Close has been called.
+func (s *Server) closed() bool {
+	select {
+	case <-s.closeChan:
+		return true
+	default:
+		return false
+	}
 }
 
+// ListenRequests returns a channel receiving every request as a string, it is closed by Close.
 func (s *Server) ListenRequests() chan string {
 	s.outChan = make(chan string, 1) //make channel asynchrone
 
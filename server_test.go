@@ -3,6 +3,9 @@ package mbserver
 import (
 	"bytes"
 	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -18,6 +21,20 @@ func isEqual(a interface{}, b interface{}) bool {
 	return true
 }
 
+// handleRequest handles a TCP request to unit 255 and returns the response.
+func handleRequest(s *Server, function uint8, data []byte) Framer {
+	var frame TCPFrame
+	frame.TransactionIdentifier = 1
+	frame.ProtocolIdentifier = 0
+	frame.Device = 255
+	frame.Function = function
+	frame.SetData(data)
+
+	var req Request
+	req.frame = &frame
+	return s.handle(&req)
+}
+
 //works
 func TestAduRegisterAndNumber(t *testing.T) {
 	var frame TCPFrame
@@ -164,6 +181,7 @@ func TestModbus(t *testing.T) {
 func TestReadRequests(t *testing.T) {
 
 	serv, _ := NewServer(255)
+	var last []byte
 
 	//create new Buff-Reader with the desired "Read" in the constructor
 
@@ -171,7 +189,7 @@ func TestReadRequests(t *testing.T) {
 	data := []byte{255, 3, 0, 12, 0, 2, 127, 128}
 	buffReader := bytes.NewBuffer(data)
 
-	req, _, err := serv.readRequests(buffReader)
+	req, _, err := serv.readRTU(buffReader, &last)
 
 	if err != nil {
 		t.Errorf("Test1 :expected nil, got %v\n", err)
@@ -182,12 +200,12 @@ func TestReadRequests(t *testing.T) {
 	}
 
 	//Valid Request but split in Buffer and Read
-	serv.last = []byte{255}
+	last = []byte{255}
 
 	data = []byte{3, 0, 12, 0, 2, 127, 128}
 	buffReader.Write(data)
 
-	req, _, err = serv.readRequests(buffReader)
+	req, _, err = serv.readRTU(buffReader, &last)
 
 	if err != nil {
 		t.Errorf("Test2 :expected nil, got %v\n", err)
@@ -199,12 +217,12 @@ func TestReadRequests(t *testing.T) {
 	}
 
 	//invalid buffer without Slave-Id and then valid Request
-	serv.last = []byte{2, 36, 36, 99}
+	last = []byte{2, 36, 36, 99}
 
 	data = []byte{255, 3, 0, 12, 0, 2, 127, 128}
 	buffReader.Write(data)
 
-	req, _, err = serv.readRequests(buffReader)
+	req, _, err = serv.readRTU(buffReader, &last)
 
 	if err != nil {
 		t.Errorf("Test3 :expected nil, got %v\n", err)
@@ -215,18 +233,18 @@ func TestReadRequests(t *testing.T) {
 	}
 
 	//invalid buffer with Slave-Id and then valid Request
-	serv.last = []byte{2, 255, 36, 99}
+	last = []byte{2, 255, 36, 99}
 
 	data = []byte{255, 3, 0, 12, 0, 2, 127, 128}
 	buffReader.Write(data)
 
-	req, _, err = serv.readRequests(buffReader)
+	req, _, err = serv.readRTU(buffReader, &last)
 
 	if err == nil {
 		t.Errorf("Test3 :expected non-nil, got %v\n", err)
 	}
 
-	req, _, err = serv.readRequests(buffReader)
+	req, _, err = serv.readRTU(buffReader, &last)
 
 	if err != nil {
 		t.Errorf("Test3 :expected nil, got %v\n", err)
@@ -237,18 +255,18 @@ func TestReadRequests(t *testing.T) {
 	}
 
 	//invalid buffer with Slave-Id and then valid Request
-	serv.last = []byte{2, 255, 36, 99, 255, 3, 0, 12, 0, 2, 127, 128}
+	last = []byte{2, 255, 36, 99, 255, 3, 0, 12, 0, 2, 127, 128}
 
 	//data = []byte{255, 3, 0, 12, 0, 2, 127, 128}
 	//buffReader.Write(data)
 
-	req, _, err = serv.readRequests(buffReader)
+	req, _, err = serv.readRTU(buffReader, &last)
 
 	if err == nil {
 		t.Errorf("Test4 :expected non-nil, got %v\n req : %v", err, req)
 	}
 
-	req, _, err = serv.readRequests(buffReader)
+	req, _, err = serv.readRTU(buffReader, &last)
 
 	if err != nil {
 		t.Errorf("Test4 :expected nil, got %v\n", err)
@@ -259,12 +277,12 @@ func TestReadRequests(t *testing.T) {
 	}
 
 	//Valid Request but split in Buffer and Read
-	serv.last = []byte{255}
+	last = []byte{255}
 
 	data = []byte{3, 0, 12, 0, 2, 127, 128, 255, 3, 0, 12, 0, 2, 127, 128}
 	buffReader.Write(data)
 
-	req, n, err := serv.readRequests(buffReader)
+	req, n, err := serv.readRTU(buffReader, &last)
 
 	if err != nil {
 		t.Errorf("Test5 :expected nil, got %v\n", err)
@@ -275,8 +293,8 @@ func TestReadRequests(t *testing.T) {
 		t.Errorf("Test5 :expected %v got %v\n", data[:n], req)
 	}
 
-	if tail := []byte{255, 3, 0, 12, 0, 2, 127, 128}; !isEqual(serv.last, tail) {
-		t.Errorf("Test 5: s.last expected %v got %v\n", tail, serv.last)
+	if tail := []byte{255, 3, 0, 12, 0, 2, 127, 128}; !isEqual(last, tail) {
+		t.Errorf("Test 5: last expected %v got %v\n", tail, last)
 	}
 
 	//test readwriteMultipleRegisters
@@ -284,16 +302,220 @@ func TestReadRequests(t *testing.T) {
 	data = []byte{255, 23, 0, 3, 0, 6, 0, 12, 0, 3, 6, 0, 200, 0, 200, 0, 200, 127, 128}
 	buffReader.Write(data)
 
-	req, _, err = serv.readRequests(buffReader)
+	req, _, err = serv.readRTU(buffReader, &last)
 
 	if !isEqual(req, []byte{255, 3, 0, 12, 0, 2, 127, 128}) {
 		t.Errorf("Test 6 : req expectet %v got %v\n", data, req)
 	}
 
-	req, _, err = serv.readRequests(buffReader)
+	req, _, err = serv.readRTU(buffReader, &last)
 
 	if !isEqual(req, data) {
 		t.Errorf("Test 6 : req expectet %v got %v\n", data, req)
 	}
 
 }
+
+func TestBroadcast(t *testing.T) {
+	s, _ := NewServer(255)
+	s.HoldingRegisters = make([]byte, 10)
+
+	var frame RTUFrame
+	frame.Address = 0
+	frame.Function = WriteHoldingRegister_fc
+	SetDataWithRegisterAndNumber(&frame, 1, 6)
+
+	req := Request{frame: &frame, broadcast: true}
+	if response := s.handle(&req); response != nil {
+		t.Errorf("expected no response, got %v", response.Bytes())
+	}
+	if s.HoldingRegisters[3] != 6 {
+		t.Errorf("expected broadcast write, got %v", s.HoldingRegisters)
+	}
+
+	frame.Function = ReadHoldingRegisters_fc
+	if response := s.handle(&req); response != nil {
+		t.Errorf("expected no response, got %v", response.Bytes())
+	}
+
+	frame.Address = 255
+	frame.Function = GetCommEventLog_fc
+	frame.Data = []byte{}
+	response := s.handle(&Request{frame: &frame})
+	// the rejected read is not counted as completed
+	expect := []byte{10, 0, 0, 0, 1, 0, 0, receiveEvent, receiveEvent | receiveBroadcast, sendEvent, receiveEvent | receiveBroadcast}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestServeConn(t *testing.T) {
+	s, _ := NewServer(1)
+	s.HoldingRegisters = make([]byte, 20)
+	s.HoldingRegisters[3] = 5
+	defer s.Close()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.ServeConn(server, FramingTCP)
+
+	request := TCPFrame{TransactionIdentifier: 3, Device: 1, Function: 3, Data: []byte{0, 1, 0, 1}}
+	go client.Write(request.Bytes())
+
+	packet := make([]byte, max_ADU_TCP)
+	n, err := client.Read(packet)
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	response, err := NewTCPFrame(packet[:n])
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	expect := []byte{2, 0, 5}
+	if !isEqual(expect, response.Data) {
+		t.Errorf("expected %v, got %v", expect, response.Data)
+	}
+}
+
+func TestCloseServedConns(t *testing.T) {
+	s, _ := NewServer(1)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	served := make(chan error)
+	go func() {
+		served <- s.ServeConn(server, FramingTCP)
+	}()
+
+	err := s.ListenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	conn, err := net.Dial("tcp", s.listeners[0].Addr().String())
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	defer conn.Close()
+	// A request makes sure that the connection is being served.
+	request := TCPFrame{TransactionIdentifier: 1, Device: 1, Function: ReadExceptionStatus_fc}
+	conn.Write(request.Bytes())
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := readTCP(conn); err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+
+	// Blocked reads of both connections end when the server is closed.
+	s.Close()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("expected nil, got %v\n", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected ServeConn to return")
+	}
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected %v, got %v", io.EOF, err)
+	}
+}
+
+func TestServeConnShortRequest(t *testing.T) {
+	s, _ := NewServer(1)
+	s.HoldingRegisters = make([]byte, 20)
+	defer s.Close()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.ServeConn(server, FramingTCP)
+
+	// The MBAP length of 3 leaves a single data byte for function 16.
+	request := TCPFrame{TransactionIdentifier: 4, Device: 1, Function: 16, Data: []byte{0}}
+	go client.Write(request.Bytes())
+
+	packet := make([]byte, max_ADU_TCP)
+	n, err := client.Read(packet)
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	response, err := NewTCPFrame(packet[:n])
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	if exception := GetException(response); exception != IllegalDataValue {
+		t.Errorf("expected %v, got %v", IllegalDataValue, exception)
+	}
+}
+
+func TestServe(t *testing.T) {
+	s, _ := NewServer(1)
+	s.HoldingRegisters = make([]byte, 20)
+
+	listen, err := net.Listen("unix", filepath.Join(t.TempDir(), "mbserver.sock"))
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+
+	served := make(chan error)
+	go func() {
+		served <- s.Serve(listen)
+	}()
+
+	conn, err := net.Dial("unix", listen.Addr().String())
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	defer conn.Close()
+
+	request := TCPFrame{TransactionIdentifier: 3, Device: 1, Function: 6, Data: []byte{0, 2, 0, 9}}
+	conn.Write(request.Bytes())
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, max_ADU_TCP)); err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	if s.HoldingRegisters[5] != 9 {
+		t.Errorf("expected 9, got %v", s.HoldingRegisters[5])
+	}
+
+	// Serve returns once the server is closed.
+	s.Close()
+	if err := <-served; err != nil {
+		t.Errorf("expected nil, got %v\n", err)
+	}
+}
+
+func TestCloseListenRequests(t *testing.T) {
+	s, _ := NewServer(1)
+	s.HoldingRegisters = make([]byte, 20)
+	requests := s.ListenRequests()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.ServeConn(server, FramingTCP)
+
+	request := TCPFrame{TransactionIdentifier: 3, Device: 1, Function: 3, Data: []byte{0, 1, 0, 1}}
+	go client.Write(request.Bytes())
+	if _, err := client.Read(make([]byte, max_ADU_TCP)); err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	<-requests
+
+	// The channel is closed once the handler returned, closing the server concurrently does no harm.
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			s.Close()
+			done <- struct{}{}
+		}()
+	}
+	<-done
+	<-done
+	select {
+	case _, ok := <-requests:
+		if ok {
+			t.Errorf("expected the channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected the channel to be closed")
+	}
+}
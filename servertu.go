@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 	"log"
+	"net"
 	"time"
 
 	"github.com/goburrow/serial"
@@ -13,84 +14,225 @@ const max_PDU = 253
 const max_ADU_RTU = 256
 const min_ADU_RTU = 4
 const max_ADU_TCP = 260
+const max_ADU_ASCII = 513 //including start and end characters
 
+var errCharacterOverrun = errors.New("RTU request exceeds the maximum ADU size")
+var errUnsupportedFunction = errors.New("Unsupported Function in this Modbus-Library")
+
+// Delays between the attempts to open a lost serial port again, doubled after every failed attempt.
+const minReconnectDelay = 100 * time.Millisecond
+const maxReconnectDelay = 30 * time.Second
+
+// PortState is the state of a serial port reported to Server.PortStateChanged.
+type PortState int
+
+const (
+	// PortConnected is reported when ListenRTU opened the port.
+	PortConnected PortState = iota
+	// PortLost is reported when reading the port failed, e.g. because the adapter was unplugged.
+	PortLost
+	// PortReopened is reported when a lost port could be opened again, the server resumes serving it.
+	PortReopened
+)
+
+func (state PortState) String() string {
+	switch state {
+	case PortConnected:
+		return "connected"
+	case PortLost:
+		return "lost"
+	case PortReopened:
+		return "reopened"
+	}
+	return "unknown"
+}
+
+// ListenRTU starts the Modbus RTU server on a serial port. Requests are delimited by the silent
+// interval of 3.5 characters at the baud rate, the port is read with a timeout of that interval.
+// If reading the port fails later on, the port is opened again until the server is closed.
 func (s *Server) ListenRTU(serialConfig *serial.Config) (err error) {
-	port, err := serial.Open(serialConfig)
+	if s.isUnit() {
+		return errUnitListen
+	}
+	config := *serialConfig
+	_, _, config.Timeout = rtuTimings(config.BaudRate)
+
+	// The lock is held while the port is opened so that it is opened only once.
+	s.sessionsMu.Lock()
+	if _, ok := s.sessions[config.Address]; ok {
+		s.sessionsMu.Unlock()
+		return errors.New("Server is already listening on " + config.Address)
+	}
+
+	port, err := s.openSerialPort(&config)
 	if err != nil {
-		log.Fatalf("failed to open %s: %v\n", serialConfig.Address, err)
+		s.sessionsMu.Unlock()
+		log.Printf("failed to open %s: %v\n", serialConfig.Address, err)
+		return err
 	}
-	s.ports = append(s.ports, port)
-	go s.acceptSerialRequests(port)
+	session := newSerialSession(port, config)
+	s.sessions[config.Address] = session
+	s.sessionsMu.Unlock()
+
+	s.portStateChanged(config.Address, PortConnected, nil)
+	go s.serveSerialRTU(session)
 	return err
 }
 
-func (s *Server) acceptSerialRequests(port io.ReadWriteCloser) {
+// serveSerialRTU serves the requests received on the serial port of the session until the server
+// is closed. A port which can not be read any more is closed and opened again.
+func (s *Server) serveSerialRTU(session *rtuSession) {
 	for {
+		err := s.acceptRTURequests(session)
+		if err == nil || s.closed() {
+			return
+		}
+
+		session.Close()
+		log.Printf("lost %s: %v\n", session.config.Address, err)
+		s.portStateChanged(session.config.Address, PortLost, err)
+
+		if !s.reopen(session) {
+			return
+		}
+		s.portStateChanged(session.config.Address, PortReopened, nil)
+	}
+}
 
+// reopen opens the serial port of the session again, it waits between the attempts with an increasing
+// delay. False is returned if the server has been closed in the meantime.
+func (s *Server) reopen(session *rtuSession) bool {
+	delay := minReconnectDelay
+	for {
 		select {
 		case <-s.closeChan:
-			close(s.requestChan)
-			return
+			return false
+		case <-time.After(delay):
+		}
+
+		port, err := s.openSerialPort(&session.config)
+		if err == nil {
+			session.setPort(port)
+			if s.closed() {
+				session.Close()
+				return false
+			}
+			return true
+		}
+
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// portStateChanged reports the state of the serial port to the PortStateChanged callback.
+func (s *Server) portStateChanged(address string, state PortState, err error) {
+	if s.PortStateChanged != nil {
+		s.PortStateChanged(address, state, err)
+	}
+}
+
+// ListenRTUOverTCP starts the Modbus server listening on "address:port" for RTU frames
+// tunneled over TCP, e.g. by serial device servers. Each connection is framed on its own.
+func (s *Server) ListenRTUOverTCP(addressPort string) (err error) {
+	if s.isUnit() {
+		return errUnitListen
+	}
+	listen, err := net.Listen("tcp", addressPort)
+	if err != nil {
+		log.Printf("Failed to Listen: %v\n", err)
+		return err
+	}
+	s.listeners = append(s.listeners, listen)
+	go s.acceptConns(listen, func(conn net.Conn) error {
+		return s.ServeConn(conn, FramingRTU)
+	})
+	return err
+}
+
+// acceptRTURequests reads RTU frames with the framer of the session until the server is closed (nil is
+// returned) or reading fails.
+func (s *Server) acceptRTURequests(session *rtuSession) error {
+	for {
+
+		select {
+		case <-s.closeChan:
+			return nil
 		default:
-			request, _, err := s.readRequests(port)
+			request, err := session.framer.readFrame()
 
 			t := time.Now()
 
 			if err != nil {
-				if err.Error() == "serial: timeout" {
-					s.last = s.last[:0]
+				if isTimeout(err) {
 					continue // timeOut error is not an issue
-				} else if err.Error() == "Unsupported Function in this Modbus-Library" {
+				} else if err == errUnsupportedFunction {
+					continue
+				} else if err == errCharacterOverrun {
+					session.inc(&session.stats.Overruns)
+					s.busError(receiveOverrun)
+					continue
+				} else if err == errFramingError {
+					session.inc(&session.stats.Timeouts)
+					s.busMessage()
+					s.busError(receiveCommError)
 					continue
 				} else {
-					log.Fatal(err) // this could be more sophisticated
+					return err
 				}
 			}
 
+			s.busMessage()
+
 			frame, err := NewRTUFrame(request)
 
 			if err != nil {
-				//discard all of the bytes of the requests until slaveID then save bytes[slaveId:] in s.last
-				n, err := find(s.slaveId, request[1:])
-				if err == nil {
-					s.last = append(request[n:], s.last...)
-				}
+				session.inc(&session.stats.CRCErrors)
+				s.busError(receiveCommError)
+				session.framer.badFrame(request)
 				log.Printf("bad serial frame error %v\n", err)
 				continue
 			}
 
-			if frame.Address != s.slaveId {
+			session.inc(&session.stats.Frames)
+
+			if !s.acceptsAddress(frame.Address) {
 				//Package is not for us so discard it; could check for this earlier ... ?!
+				session.inc(&session.stats.ForeignFrames)
 				continue
 			}
 
-			s.requestChan <- &Request{port, frame, t}
+			s.send(&Request{conn: session, frame: frame, t: t, unitId: frame.Address, broadcast: frame.Address == 0})
 
 		}
 
 	}
 }
 
-func (s *Server) readRequests(reader io.Reader) ([]byte, int, error) {
+// acceptsAddress reports whether serial requests to address are handled by the server,
+// which is the case for its own address, the addresses of its units and broadcasts.
+func (s *Server) acceptsAddress(address uint8) bool {
+	return address == 0 || s.unit(address) != nil
+}
+
+// readRTU reads one RTU request from reader, the bytes left over from the previous read are
+// taken from last and the bytes following the request are stored there.
+func (s *Server) readRTU(reader io.Reader, last *[]byte) ([]byte, int, error) {
 	var err error
 	req := make([]byte, max_ADU_RTU+3)
 	expected := min_ADU_RTU
 	read := 0
 
-	if len(s.last) != 0 {
-		n, err := find(s.slaveId, s.last)
-		if err == nil {
-			read += copy(req, s.last[n:])
-		}
-		s.last = s.last[:0]
-	}
+	// The bytes left over normally start with the next request, garbage before it is skipped.
+	read += copy(req, s.resync(*last))
+	*last = (*last)[:0]
 
 	expected, err = s.getRTUSizeFromHeader(req[:read])
 
 	if err != nil {
-		n, err2 := find(s.slaveId, req[1:read])
-		if err2 == nil {
-			s.last = req[n:read]
+		if read > 0 {
+			*last = s.resync(req[1:read])
 		}
 		return nil, read, err
 	}
@@ -100,11 +242,14 @@ func (s *Server) readRequests(reader io.Reader) ([]byte, int, error) {
 		n, err := reader.Read(req[read:])
 		read += n
 		if err != nil {
-			s.last = append(s.last, req[:read]...)
+			*last = append(*last, req[:read]...)
 			return nil, read, err
 		}
 
 		expected, err = s.getRTUSizeFromHeader(req[:read])
+		if expected > max_ADU_RTU {
+			return nil, read, errCharacterOverrun
+		}
 		/*
 			if err != nil {
 				n, err := find(s.slaveId, s.last[1:])
@@ -118,7 +263,7 @@ func (s *Server) readRequests(reader io.Reader) ([]byte, int, error) {
 	}
 
 	if read > expected {
-		s.last = append(s.last[:0], req[expected:read]...)
+		*last = append((*last)[:0], req[expected:read]...)
 
 		return req[:expected], expected, nil
 	}
@@ -126,10 +271,37 @@ func (s *Server) readRequests(reader io.Reader) ([]byte, int, error) {
 	return req[:read], read, nil
 }
 
+// RequestLength returns the size of a request PDU, function code included, from the bytes
+// of the PDU received so far. If there are not enough bytes to tell, the maximum PDU size
+// of 253 bytes is returned.
+type RequestLength func(pdu []byte) (int, error)
+
+// FixedRequestLength returns a RequestLength for requests with a PDU of n bytes.
+func FixedRequestLength(n int) RequestLength {
+	return func(pdu []byte) (int, error) {
+		return n, nil
+	}
+}
+
+// ByteCountRequestLength returns a RequestLength for requests with a byte count at offset
+// (the function code is at offset 0) which is followed by as many bytes.
+func ByteCountRequestLength(offset int) RequestLength {
+	return func(pdu []byte) (int, error) {
+		if len(pdu) <= offset {
+			return max_PDU, nil
+		}
+		return offset + 1 + int(pdu[offset]), nil
+	}
+}
+
 func (s *Server) getPDUSizeFromHeader(header []byte) (int, error) {
 
 	fc := uint8(header[0])
 
+	if length, ok := s.requestLength[fc]; ok {
+		return length(header)
+	}
+
 	switch fc {
 	case ReadCoils_fc, ReadDiscreteInput_fc, ReadHoldingRegisters_fc, ReadInputRegisters_fc, WriteSingleCoil_fc, WriteHoldingRegister_fc:
 		return 5, nil
@@ -140,6 +312,9 @@ func (s *Server) getPDUSizeFromHeader(header []byte) (int, error) {
 		}
 		return max_PDU, nil
 
+	case Diagnostics_fc:
+		return 5, nil
+
 	case ReadExceptionStatus_fc, GetCommEventCounter_fc, GetCommEventLog_fc, ReportSlaveId_fc:
 		return 1, nil
 
@@ -147,12 +322,12 @@ func (s *Server) getPDUSizeFromHeader(header []byte) (int, error) {
 		return 3, nil
 
 	case ReadDeviceIdentification_fc:
-		return 4, nil
+		return s.getMEISizeFromHeader(header)
 
 	case MaskWriteRegister_fc:
 		return 7, nil
 
-	case WriteFileRecord_fc:
+	case ReadFileRecord_fc, WriteFileRecord_fc:
 		if len(header) < 2 {
 			return max_PDU, nil
 		}
@@ -165,7 +340,7 @@ func (s *Server) getPDUSizeFromHeader(header []byte) (int, error) {
 		return int(header[9]) + 10, nil
 
 	default:
-		return 0, errors.New("Unsupported Function in this Modbus-Library")
+		return 0, errUnsupportedFunction
 
 	}
 }
@@ -177,28 +352,25 @@ func (s *Server) getRTUSizeFromHeader(header []byte) (x int, err error) {
 		return max_PDU, nil
 	}
 
-	x, err = s.getPDUSizeFromHeader(header[1:])
+	// Length rules of custom functions are registered on the addressed unit,
+	// broadcasts and requests to unknown addresses use those of s.
+	unit := s.unit(header[0])
+	if unit == nil {
+		unit = s
+	}
+	x, err = unit.getPDUSizeFromHeader(header[1:])
 	x += 3
 
 	return
 }
 
-func find(x byte, data []byte) (uint, error) {
-
-	if len(data) == 0 {
-		return 0, errors.New("Empty Byte-Slice")
-	}
-
-	var n uint
-
-	n = 0
-
-	for n < uint(len(data)) {
-		if data[n] == x {
-			return n, nil
+// resync returns the bytes of data from the first address accepted by the server (see acceptsAddress)
+// on, nil if there is none. It finds the start of the next request in a stream after a bad one.
+func (s *Server) resync(data []byte) []byte {
+	for n := 0; n < len(data); n++ {
+		if s.acceptsAddress(data[n]) {
+			return data[n:]
 		}
-		n++
 	}
-
-	return 0, errors.New("Slave Id not found in Server.last")
+	return nil
 }
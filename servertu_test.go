@@ -0,0 +1,207 @@
+package mbserver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+func TestReadRequestsCustomFunction(t *testing.T) {
+	serv, _ := NewServer(255)
+
+	handler := func(s *Server, frame Framer) ([]byte, *Exception) {
+		return frame.GetData(), &Success
+	}
+
+	data := []byte{255, 101, 1, 2, 3}
+	data = append(data, 0, 0)
+	crc := crcModbus(data[:5])
+	data[5], data[6] = byte(crc), byte(crc>>8)
+
+	serv.RegisterFunctionHandlerWithLength(101, handler, FixedRequestLength(4))
+
+	req, _, err := serv.readRTU(bytes.NewBuffer(data), new([]byte))
+	if err != nil {
+		t.Errorf("expected nil, got %v\n", err)
+	}
+	if !isEqual(data, req) {
+		t.Errorf("expected %v got %v\n", data, req)
+	}
+
+	// byte count at offset 1 followed by 3 bytes
+	data = []byte{255, 102, 3, 7, 8, 9, 0, 0}
+	crc = crcModbus(data[:6])
+	data[6], data[7] = byte(crc), byte(crc>>8)
+	serv.RegisterFunctionHandlerWithLength(102, handler, ByteCountRequestLength(1))
+
+	req, _, err = serv.readRTU(bytes.NewBuffer(data), new([]byte))
+	if err != nil {
+		t.Errorf("expected nil, got %v\n", err)
+	}
+	if !isEqual(data, req) {
+		t.Errorf("expected %v got %v\n", data, req)
+	}
+}
+
+func TestListenRTUOverTCP(t *testing.T) {
+	serv, _ := NewServer(1)
+	serv.HoldingRegisters = make([]byte, 20)
+	serv.HoldingRegisters[3] = 5
+	defer serv.Close()
+
+	err := serv.ListenRTUOverTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	address := serv.listeners[0].Addr().String()
+
+	// Two connections, the first one sends its request in two parts.
+	first, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	defer first.Close()
+	second, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	defer second.Close()
+
+	request := []byte{1, 3, 0, 1, 0, 1, 0, 0}
+	crc := crcModbus(request[:6])
+	request[6], request[7] = byte(crc), byte(crc>>8)
+
+	first.Write(request[:3])
+	second.Write(request)
+	time.Sleep(10 * time.Millisecond)
+	first.Write(request[3:])
+
+	for _, conn := range []net.Conn{first, second} {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		response := make([]byte, 7)
+		if _, err := io.ReadFull(conn, response); err != nil {
+			t.Fatalf("expected nil, got %v\n", err)
+		}
+		frame, err := NewRTUFrame(response)
+		if err != nil {
+			t.Fatalf("expected nil, got %v\n", err)
+		}
+		expect := []byte{2, 0, 5}
+		if !isEqual(expect, frame.Data) {
+			t.Errorf("expected %v got %v\n", expect, frame.Data)
+		}
+	}
+}
+
+func TestListenRTUOverTCPPipelined(t *testing.T) {
+	serv, _ := NewServer(1)
+	defer serv.Close()
+	unit, _ := serv.AddUnit(5)
+	unit.HoldingRegisters = make([]byte, 20)
+
+	err := serv.ListenRTUOverTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	conn, err := net.Dial("tcp", serv.listeners[0].Addr().String())
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	defer conn.Close()
+
+	// A broadcast and two requests to the unit in one segment, only the unit answers.
+	var requests []byte
+	requests = append(requests, (&RTUFrame{Address: 0, Function: 6, Data: []byte{0, 1, 0, 7}}).Bytes()...)
+	for i := 0; i < 2; i++ {
+		requests = append(requests, (&RTUFrame{Address: 5, Function: 3, Data: []byte{0, 1, 0, 1}}).Bytes()...)
+	}
+	conn.Write(requests)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for i := 0; i < 2; i++ {
+		response := make([]byte, 7)
+		if _, err := io.ReadFull(conn, response); err != nil {
+			t.Fatalf("expected nil, got %v\n", err)
+		}
+		frame, err := NewRTUFrame(response)
+		if err != nil {
+			t.Fatalf("expected nil, got %v\n", err)
+		}
+		expect := []byte{2, 0, 7}
+		if frame.Address != 5 || !isEqual(expect, frame.Data) {
+			t.Errorf("expected %v from unit 5, got %v from %v\n", expect, frame.Data, frame.Address)
+		}
+	}
+}
+
+// pipePort emulates a serial port read with a timeout on one end of a net.Pipe, the deadline
+// error is a timeout error.
+type pipePort struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (p *pipePort) Read(b []byte) (int, error) {
+	p.SetReadDeadline(time.Now().Add(p.timeout))
+	return p.Conn.Read(b)
+}
+
+func TestListenRTUReconnect(t *testing.T) {
+	clients := make(chan net.Conn, 2)
+	attempts := 0
+
+	serv, _ := NewServer(1)
+	serv.SerialOpener = SerialOpenerFunc(func(config *serial.Config) (SerialPort, error) {
+		attempts++
+		if attempts == 2 {
+			return nil, errors.New("no such device")
+		}
+		server, client := net.Pipe()
+		clients <- client
+		return &pipePort{server, config.Timeout}, nil
+	})
+	serv.HoldingRegisters = make([]byte, 20)
+	serv.HoldingRegisters[3] = 5
+	states := make(chan PortState, 4)
+	serv.PortStateChanged = func(address string, state PortState, err error) {
+		states <- state
+	}
+	defer serv.Close()
+
+	err := serv.ListenRTU(&serial.Config{Address: "/dev/test", BaudRate: 19200})
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+
+	request := (&RTUFrame{Address: 1, Function: 3, Data: []byte{0, 1, 0, 1}}).Bytes()
+	poll := func(client net.Conn) {
+		client.SetDeadline(time.Now().Add(time.Second))
+		client.Write(request)
+		response := make([]byte, 7)
+		if _, err := io.ReadFull(client, response); err != nil {
+			t.Fatalf("expected nil, got %v\n", err)
+		}
+		if expect := []byte{1, 3, 2, 0, 5}; !isEqual(expect, response[:5]) {
+			t.Errorf("expected %v got %v\n", expect, response[:5])
+		}
+	}
+
+	client := <-clients
+	poll(client)
+
+	// Unplug the adapter, the port is opened again on the second attempt.
+	client.Close()
+	client = <-clients
+	poll(client)
+
+	for _, expect := range []PortState{PortConnected, PortLost, PortReopened} {
+		if state := <-states; state != expect {
+			t.Errorf("expected %v, got %v", expect, state)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package mbserver
 
 import (
+	"encoding/binary"
+	"errors"
 	"io"
 	"log"
 	"net"
@@ -8,64 +10,77 @@ import (
 	"time"
 )
 
+var errMBAPHeader = errors.New("TCP Frame error: protocol identifier is not 0 or length out of range")
+
 func (s *Server) accept(listen net.Listener) error {
+	return s.acceptConns(listen, func(conn net.Conn) error {
+		return s.ServeConn(conn, FramingTCP)
+	})
+}
+
+// serveTCPConn reads MBAP framed requests from conn until the server is closed (nil is returned) or
+// reading fails. The role is set for Modbus/TCP Security connections, it is nil otherwise.
+func (s *Server) serveTCPConn(conn io.ReadWriteCloser, role *string) error {
 	for {
+
 		select {
 		case <-s.closeChan:
-			close(s.requestChan)
 			return nil
 		default:
 
-			conn, err := listen.Accept()
+			packet, err := readTCP(conn)
+			t := time.Now()
+			if err == errMBAPHeader {
+				// The stream can not be synchronized again.
+				s.busMessage()
+				s.busError(receiveCommError)
+				return err
+			} else if err != nil {
+				return err
+			}
+
+			s.busMessage()
+
+			frame, err := NewTCPFrame(packet)
 			if err != nil {
-				if strings.Contains(err.Error(), "use of closed network connection") {
-					return nil
-				}
-				log.Printf("Unable to accept connections: %#v\n", err)
+				s.busError(receiveCommError)
 				return err
 			}
 
-			go func(conn net.Conn) {
-				defer conn.Close()
-
-				for {
-
-					select {
-					case <-s.closeChan:
-						return
-					default:
-
-						packet := make([]byte, 512)
-						bytesRead, err := conn.Read(packet)
-						t := time.Now()
-						if err != nil {
-							if err != io.EOF {
-								log.Printf("read error %v\n", err)
-							}
-							return
-						}
-						// Set the length of the packet to the number of read bytes.
-						packet = packet[:bytesRead]
-
-						frame, err := NewTCPFrame(packet)
-						if err != nil {
-							log.Printf("bad packet error %v\n", err)
-							return
-						}
-
-						request := &Request{conn, frame, t}
-
-						s.requestChan <- request
-					}
-				}
-			}(conn)
+			request := &Request{conn: conn, frame: frame, t: t, unitId: frame.Device, broadcast: s.TCPBroadcast && frame.Device == 0, role: role}
+
+			s.send(request)
 		}
 	}
+}
+
+// readTCP reads one request from the stream using the length field of its MBAP header,
+// several requests sent back-to-back are read one after the other.
+func readTCP(reader io.Reader) ([]byte, error) {
+	packet := make([]byte, max_ADU_TCP)
+
+	if _, err := io.ReadFull(reader, packet[:7]); err != nil {
+		return nil, err
+	}
+
+	protocol := binary.BigEndian.Uint16(packet[2:4])
+	length := int(binary.BigEndian.Uint16(packet[4:6]))
+	if protocol != 0 || length < 2 || 6+length > max_ADU_TCP {
+		return nil, errMBAPHeader
+	}
 
+	if _, err := io.ReadFull(reader, packet[7:6+length]); err != nil {
+		return nil, err
+	}
+
+	return packet[:6+length], nil
 }
 
 // ListenTCP starts the Modbus server listening on "address:port".
 func (s *Server) ListenTCP(addressPort string) (err error) {
+	if s.isUnit() {
+		return errUnitListen
+	}
 	listen, err := net.Listen("tcp", addressPort)
 	if err != nil {
 		log.Printf("Failed to Listen: %v\n", err)
@@ -75,3 +90,39 @@ func (s *Server) ListenTCP(addressPort string) (err error) {
 	go s.accept(listen)
 	return err
 }
+
+// Serve accepts Modbus TCP connections on listen until it is closed, e.g. to serve a Unix domain socket.
+// The listener is closed by Close.
+func (s *Server) Serve(listen net.Listener) error {
+	if s.isUnit() {
+		return errUnitListen
+	}
+	s.listeners = append(s.listeners, listen)
+	return s.accept(listen)
+}
+
+// acceptConns accepts connections on listen and serves each of them with serve in its own
+// go-routine, the connection is closed when serve returns or the server is closed.
+func (s *Server) acceptConns(listen net.Listener, serve func(conn net.Conn) error) error {
+	for {
+		conn, err := listen.Accept()
+		if err != nil {
+			if strings.Contains(err.Error(), "use of closed network connection") {
+				return nil
+			}
+			log.Printf("Unable to accept connections: %#v\n", err)
+			return err
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+			if !s.track(conn) {
+				return
+			}
+			defer s.untrack(conn)
+			if err := serve(conn); err != nil && !s.closed() {
+				log.Printf("connection error %v\n", err)
+			}
+		}(conn)
+	}
+}
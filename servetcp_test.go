@@ -0,0 +1,109 @@
+package mbserver
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReadTCP(t *testing.T) {
+	first := (&TCPFrame{TransactionIdentifier: 1, Device: 1, Function: 3, Data: []byte{0, 1, 0, 1}}).Bytes()
+	second := (&TCPFrame{TransactionIdentifier: 2, Device: 1, Function: 6, Data: []byte{0, 1, 0, 7}}).Bytes()
+
+	reader := bytes.NewBuffer(append(append([]byte{}, first...), second...))
+	for _, expect := range [][]byte{first, second} {
+		packet, err := readTCP(reader)
+		if err != nil {
+			t.Fatalf("expected nil, got %v\n", err)
+		}
+		if !isEqual(expect, packet) {
+			t.Errorf("expected %v, got %v", expect, packet)
+		}
+	}
+
+	// protocol identifier 1
+	_, err := readTCP(bytes.NewBuffer([]byte{0, 1, 0, 1, 0, 6, 1, 3, 0, 1, 0, 1}))
+	if err != errMBAPHeader {
+		t.Errorf("expected %v, got %v", errMBAPHeader, err)
+	}
+
+	// length exceeds max_ADU_TCP
+	_, err = readTCP(bytes.NewBuffer([]byte{0, 1, 0, 0, 1, 0, 1, 3, 0, 1, 0, 1}))
+	if err != errMBAPHeader {
+		t.Errorf("expected %v, got %v", errMBAPHeader, err)
+	}
+}
+
+// serveTCPRequest sends the request over a connection served with ServeConn and returns the response.
+func serveTCPRequest(t *testing.T, s *Server, device, function uint8, data []byte) *TCPFrame {
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.ServeConn(server, FramingTCP)
+
+	request := TCPFrame{TransactionIdentifier: 1, Device: device, Function: function, Data: data}
+	go client.Write(request.Bytes())
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	packet, err := readTCP(client)
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	response, err := NewTCPFrame(packet)
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	return response
+}
+
+func TestNewTCPFrameWithoutData(t *testing.T) {
+	frame, err := NewTCPFrame([]byte{0, 1, 0, 0, 0, 2, 1, GetCommEventCounter_fc})
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	if frame.Function != GetCommEventCounter_fc || len(frame.Data) != 0 {
+		t.Errorf("expected function %v without data, got %v %v", GetCommEventCounter_fc, frame.Function, frame.Data)
+	}
+
+	if _, err := NewTCPFrame([]byte{0, 1, 0, 0, 0, 1, 1}); err == nil {
+		t.Errorf("expected an error, got nil")
+	}
+}
+
+func TestServeConnPipelined(t *testing.T) {
+	s, _ := NewServer(1)
+	s.HoldingRegisters = make([]byte, 20)
+	defer s.Close()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.ServeConn(server, FramingTCP)
+
+	var requests []byte
+	for i := 1; i <= 3; i++ {
+		frame := TCPFrame{TransactionIdentifier: uint16(i), Device: 1, Function: 6, Data: []byte{0, 1, 0, byte(i)}}
+		requests = append(requests, frame.Bytes()...)
+	}
+
+	// The first request is split, the other two follow in one write.
+	go func() {
+		client.Write(requests[:5])
+		time.Sleep(10 * time.Millisecond)
+		client.Write(requests[5:])
+	}()
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	for i := 1; i <= 3; i++ {
+		packet, err := readTCP(client)
+		if err != nil {
+			t.Fatalf("expected nil, got %v\n", err)
+		}
+		response, _ := NewTCPFrame(packet)
+		if int(response.TransactionIdentifier) != i {
+			t.Errorf("expected %v, got %v", i, response.TransactionIdentifier)
+		}
+	}
+	if s.HoldingRegisters[3] != 3 {
+		t.Errorf("expected 3, got %v", s.HoldingRegisters[3])
+	}
+}
@@ -0,0 +1,127 @@
+package mbserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+)
+
+// ModbusRoleOID is the object identifier of the X.509 extension holding the Modbus role of a
+// Modbus/TCP Security client.
+var ModbusRoleOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 50316, 802, 1}
+
+// Authorizer decides whether a client with the role may execute the function on quantity
+// items starting at address. Address and quantity are 0 for functions without an address range.
+type Authorizer func(role string, function uint8, address, quantity int) bool
+
+// ListenTLS starts the Modbus/TCP Security server listening on "address:port", usually port 802.
+// The config has to provide the server certificate and the pool of CAs the client certificates are
+// verified against, clients without a valid certificate are rejected.
+func (s *Server) ListenTLS(addressPort string, config *tls.Config) (err error) {
+	if s.isUnit() {
+		return errUnitListen
+	}
+	config = config.Clone()
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+
+	listen, err := tls.Listen("tcp", addressPort, config)
+	if err != nil {
+		log.Printf("Failed to Listen: %v\n", err)
+		return err
+	}
+	s.listeners = append(s.listeners, listen)
+	go s.acceptConns(listen, s.serveTLSConn)
+	return err
+}
+
+// serveTLSConn completes the handshake and serves the requests of the connection with the
+// role of the client certificate.
+func (s *Server) serveTLSConn(conn net.Conn) error {
+	tlsConn := conn.(*tls.Conn)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+
+	role, err := modbusRole(tlsConn.ConnectionState().PeerCertificates[0])
+	if err != nil {
+		return err
+	}
+
+	err = s.serveTCPConn(conn, &role)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// modbusRole returns the role of the certificate, the empty string if it has none.
+func modbusRole(cert *x509.Certificate) (string, error) {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(ModbusRoleOID) {
+			var role string
+			if _, err := asn1.Unmarshal(ext.Value, &role); err != nil {
+				return "", err
+			}
+			return role, nil
+		}
+	}
+	return "", nil
+}
+
+// authorized reports whether the request may be executed, which is always the case for requests
+// not received over TLS and if the server has no Authorize callback. Requests to a unit are
+// authorized by the Server it was added to.
+func (s *Server) authorized(request *Request) bool {
+	authorize := s.Authorize
+	if s.isUnit() {
+		authorize = s.root.Authorize
+	}
+	if request.role == nil || authorize == nil {
+		return true
+	}
+	function := request.frame.GetFunction()
+	for _, r := range addressRanges(request.frame) {
+		if !authorize(*request.role, function, r.address, r.quantity) {
+			return false
+		}
+	}
+	return true
+}
+
+type addressRange struct {
+	address  int
+	quantity int
+}
+
+// addressRanges returns the items accessed by the request, Read/Write Multiple Registers accesses two ranges.
+func addressRanges(frame Framer) []addressRange {
+	data := frame.GetData()
+
+	switch frame.GetFunction() {
+	case ReadCoils_fc, ReadDiscreteInput_fc, ReadHoldingRegisters_fc, ReadInputRegisters_fc,
+		WriteMultipleCoils_fc, WriteHoldingRegisters_fc:
+		if len(data) >= 4 {
+			register, numRegs, _ := RegisterAddressAndNumber(frame)
+			return []addressRange{{register, numRegs}}
+		}
+
+	case WriteSingleCoil_fc, WriteHoldingRegister_fc, MaskWriteRegister_fc:
+		if len(data) >= 2 {
+			return []addressRange{{int(binary.BigEndian.Uint16(data[0:2])), 1}}
+		}
+
+	case ReadWriteMultipleRegisters_fc:
+		if len(data) >= 8 {
+			return []addressRange{
+				{int(binary.BigEndian.Uint16(data[0:2])), int(binary.BigEndian.Uint16(data[2:4]))},
+				{int(binary.BigEndian.Uint16(data[4:6])), int(binary.BigEndian.Uint16(data[6:8]))},
+			}
+		}
+	}
+
+	return []addressRange{{0, 0}}
+}
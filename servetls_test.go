@@ -0,0 +1,143 @@
+package mbserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestCertificate returns a certificate signed by parent, self-signed if parent is nil.
+func newTestCertificate(t *testing.T, serial int64, parent *tls.Certificate, role string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "mbserver test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	if role != "" {
+		value, _ := asn1.MarshalWithParams(role, "utf8")
+		template.ExtraExtensions = []pkix.Extension{{Id: ModbusRoleOID, Value: value}}
+	}
+
+	signer, signerKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestListenTLS(t *testing.T) {
+	ca := newTestCertificate(t, 1, nil, "")
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	serv, _ := NewServer(1)
+	serv.HoldingRegisters = make([]byte, 20)
+	serv.Authorize = func(role string, function uint8, address, quantity int) bool {
+		return role == "Operator" || function == ReadHoldingRegisters_fc && address+quantity <= 5
+	}
+	defer serv.Close()
+
+	unit, _ := serv.AddUnit(2)
+	unit.HoldingRegisters = make([]byte, 20)
+
+	err := serv.ListenTLS("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{newTestCertificate(t, 2, &ca, "")},
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	address := serv.listeners[0].Addr().String()
+
+	// A client without a certificate is rejected.
+	conn, err := tls.Dial("tcp", address, &tls.Config{RootCAs: pool})
+	if err == nil {
+		conn.SetDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	if err == nil {
+		t.Errorf("expected an error, got nil")
+	}
+
+	conn, err = tls.Dial("tcp", address, &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{newTestCertificate(t, 3, &ca, "Viewer")},
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	request := func(device, function uint8, data []byte) *TCPFrame {
+		frame := TCPFrame{TransactionIdentifier: 1, Device: device, Function: function, Data: data}
+		conn.Write(frame.Bytes())
+		packet := make([]byte, max_ADU_TCP)
+		n, err := conn.Read(packet)
+		if err != nil {
+			t.Fatalf("expected nil, got %v\n", err)
+		}
+		response, err := NewTCPFrame(packet[:n])
+		if err != nil {
+			t.Fatalf("expected nil, got %v\n", err)
+		}
+		return response
+	}
+
+	response := request(1, ReadHoldingRegisters_fc, []byte{0, 1, 0, 4})
+	if response.Function != ReadHoldingRegisters_fc {
+		t.Errorf("expected %v, got %v", ReadHoldingRegisters_fc, response.Function)
+	}
+
+	response = request(1, ReadHoldingRegisters_fc, []byte{0, 1, 0, 5})
+	expect := []byte{byte(IllegalFunction)}
+	if response.Function != ReadHoldingRegisters_fc|0x80 || !isEqual(expect, response.Data) {
+		t.Errorf("expected IllegalFunction, got %v %v", response.Function, response.Data)
+	}
+
+	response = request(1, WriteHoldingRegister_fc, []byte{0, 1, 0, 4})
+	if response.Function != WriteHoldingRegister_fc|0x80 || !isEqual(expect, response.Data) {
+		t.Errorf("expected IllegalFunction, got %v %v", response.Function, response.Data)
+	}
+
+	// The requests to a unit are authorized by the server it was added to.
+	response = request(2, ReadHoldingRegisters_fc, []byte{0, 1, 0, 4})
+	if response.Function != ReadHoldingRegisters_fc {
+		t.Errorf("expected %v, got %v", ReadHoldingRegisters_fc, response.Function)
+	}
+
+	response = request(2, WriteHoldingRegister_fc, []byte{0, 1, 0, 4})
+	if response.Function != WriteHoldingRegister_fc|0x80 || !isEqual(expect, response.Data) {
+		t.Errorf("expected IllegalFunction, got %v %v", response.Function, response.Data)
+	}
+	if unit.HoldingRegisters[3] != 0 {
+		t.Errorf("expected the unit to be unchanged, got %v", unit.HoldingRegisters)
+	}
+}
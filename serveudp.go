@@ -0,0 +1,75 @@
+package mbserver
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// udpConn answers a request received over UDP with a datagram to its sender.
+type udpConn struct {
+	conn net.PacketConn
+	addr net.Addr
+}
+
+func (c *udpConn) Read(p []byte) (int, error) {
+	return 0, errors.New("UDP requests are read from the listening socket")
+}
+
+func (c *udpConn) Write(p []byte) (int, error) {
+	return c.conn.WriteTo(p, c.addr)
+}
+
+// Close does nothing, the socket is shared with the other clients.
+func (c *udpConn) Close() error {
+	return nil
+}
+
+// ListenUDP starts the Modbus server listening for MBAP framed datagrams on "address:port".
+func (s *Server) ListenUDP(addressPort string) (err error) {
+	if s.isUnit() {
+		return errUnitListen
+	}
+	conn, err := net.ListenPacket("udp", addressPort)
+	if err != nil {
+		log.Printf("Failed to Listen: %v\n", err)
+		return err
+	}
+	s.packetConns = append(s.packetConns, conn)
+	go s.acceptDatagrams(conn)
+	return err
+}
+
+func (s *Server) acceptDatagrams(conn net.PacketConn) error {
+	for {
+		select {
+		case <-s.closeChan:
+			return nil
+		default:
+			packet := make([]byte, max_ADU_TCP)
+			bytesRead, addr, err := conn.ReadFrom(packet)
+			t := time.Now()
+			if err != nil {
+				if strings.Contains(err.Error(), "use of closed network connection") {
+					return nil
+				}
+				log.Printf("read error %v\n", err)
+				return err
+			}
+
+			s.busMessage()
+
+			frame, err := NewTCPFrame(packet[:bytesRead])
+			if err != nil {
+				// A malformed datagram is dropped, the socket keeps serving the other clients.
+				s.busError(receiveCommError)
+				log.Printf("bad packet error %v\n", err)
+				continue
+			}
+
+			s.send(&Request{conn: &udpConn{conn, addr}, frame: frame, t: t, unitId: frame.Device, broadcast: s.TCPBroadcast && frame.Device == 0})
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package mbserver
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenUDP(t *testing.T) {
+	serv, _ := NewServer(1)
+	serv.HoldingRegisters = make([]byte, 20)
+	serv.HoldingRegisters[3] = 5
+	defer serv.Close()
+
+	err := serv.ListenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+
+	conn, err := net.Dial("udp", serv.packetConns[0].LocalAddr().String())
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	defer conn.Close()
+
+	// A malformed datagram does not stop the server.
+	conn.Write([]byte{0, 1, 0})
+
+	request := TCPFrame{TransactionIdentifier: 7, Device: 1, Function: 3, Data: []byte{0, 1, 0, 1}}
+	conn.Write(request.Bytes())
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	packet := make([]byte, max_ADU_TCP)
+	n, err := conn.Read(packet)
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+
+	response, err := NewTCPFrame(packet[:n])
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	if response.TransactionIdentifier != 7 {
+		t.Errorf("expected 7, got %v", response.TransactionIdentifier)
+	}
+	expect := []byte{2, 0, 5}
+	if !isEqual(expect, response.Data) {
+		t.Errorf("expected %v, got %v", expect, response.Data)
+	}
+}
+
+func TestListenUDPShortRequest(t *testing.T) {
+	serv, _ := NewServer(1)
+	serv.HoldingRegisters = make([]byte, 20)
+	defer serv.Close()
+
+	err := serv.ListenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+
+	conn, err := net.Dial("udp", serv.packetConns[0].LocalAddr().String())
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	defer conn.Close()
+
+	// A well-formed MBAP header with a PDU shorter than function 3 requires.
+	request := TCPFrame{TransactionIdentifier: 8, Device: 1, Function: 3, Data: []byte{0}}
+	conn.Write(request.Bytes())
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	packet := make([]byte, max_ADU_TCP)
+	n, err := conn.Read(packet)
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+
+	response, err := NewTCPFrame(packet[:n])
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	if exception := GetException(response); exception != IllegalDataValue {
+		t.Errorf("expected %v, got %v", IllegalDataValue, exception)
+	}
+}
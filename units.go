@@ -0,0 +1,100 @@
+package mbserver
+
+import "errors"
+
+var errUnitListen = errors.New("A unit is served by the Server it was added to and can not listen itself")
+
+// AddUnit adds a virtual device which is served under the unit id on the same TCP ports and serial
+// lines as s. The returned Server has its own memory maps, function handlers and counters; it is
+// configured like the Server returned by NewServer but can not listen itself, its Listen and Serve
+// methods return an error and Close does nothing.
+// Units should be added before the server starts listening. Once units are added, TCP requests
+// are routed by their unit id and requests to unknown unit ids are answered with GatewayPathUnavailable,
+// serial requests to unknown addresses are ignored.
+func (s *Server) AddUnit(id uint8) (*Server, error) {
+	if s.units == nil {
+		return nil, errors.New("Units can only be added to a Server returned by NewServer")
+	}
+	if id == 0 {
+		return nil, errors.New("Modbus Unit Id must not be set to 0")
+	}
+	if s.unit(id) != nil {
+		return nil, errors.New("Modbus Unit Id is already in use")
+	}
+	unit := newServer(id)
+	unit.root = s
+	s.units[id] = unit
+	return unit, nil
+}
+
+// isUnit reports whether s was created by AddUnit.
+func (s *Server) isUnit() bool {
+	return s.root != nil
+}
+
+// Unit returns the server for the unit id, nil if there is none.
+func (s *Server) Unit(id uint8) *Server {
+	return s.unit(id)
+}
+
+// unit returns the server which handles requests to the unit id, nil if there is none.
+func (s *Server) unit(id uint8) *Server {
+	if id == s.slaveId {
+		return s
+	}
+	return s.units[id]
+}
+
+// allUnits returns s and all of its units.
+func (s *Server) allUnits() []*Server {
+	units := make([]*Server, 0, 1+len(s.units))
+	units = append(units, s)
+	for _, unit := range s.units {
+		units = append(units, unit)
+	}
+	return units
+}
+
+// route hands the request to the unit it is sent to and returns the response.
+// Broadcast requests are handled by every unit.
+func (s *Server) route(request *Request) Framer {
+	if request.broadcast {
+		for _, unit := range s.allUnits() {
+			unit.handle(request)
+		}
+		return nil
+	}
+
+	if len(s.units) == 0 {
+		return s.handle(request)
+	}
+
+	unit := s.unit(request.unitId)
+	if unit == nil {
+		response := request.frame.Copy()
+		response.SetException(&GatewayPathUnavailable)
+		return response
+	}
+	return unit.handle(request)
+}
+
+// busMessage counts a message received on a bus for the server and all of its units,
+// every device on a bus sees all messages.
+func (s *Server) busMessage() {
+	for _, unit := range s.allUnits() {
+		unit.diag.inc(&unit.diag.busMessages)
+	}
+}
+
+// busError counts a faulty message received on a bus for the server and all of its units,
+// flags is either receiveCommError or receiveOverrun.
+func (s *Server) busError(flags uint8) {
+	for _, unit := range s.allUnits() {
+		if flags&receiveOverrun != 0 {
+			unit.diag.inc(&unit.diag.charOverruns)
+		} else {
+			unit.diag.inc(&unit.diag.busCommErrors)
+		}
+		unit.logReceiveEvent(flags)
+	}
+}
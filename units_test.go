@@ -0,0 +1,122 @@
+package mbserver
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestUnits(t *testing.T) {
+	s, _ := NewServer(1)
+	s.HoldingRegisters = make([]byte, 10)
+
+	unit, err := s.AddUnit(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unit.HoldingRegisters = make([]byte, 10)
+
+	if _, err = s.AddUnit(1); err == nil {
+		t.Errorf("expected error for unit id in use, got nil")
+	}
+	if s.Unit(2) != unit {
+		t.Errorf("expected Unit to return unit 2")
+	}
+
+	var frame TCPFrame
+	frame.Device = 2
+	frame.Function = WriteHoldingRegister_fc
+	SetDataWithRegisterAndNumber(&frame, 1, 6)
+
+	response := s.route(&Request{frame: &frame, unitId: 2})
+	exception := GetException(response)
+	if exception != Success {
+		t.Fatalf("expected Success, got %v", exception.String())
+	}
+	if unit.HoldingRegisters[3] != 6 || s.HoldingRegisters[3] != 0 {
+		t.Errorf("expected write to unit 2 only, got %v and %v", s.HoldingRegisters, unit.HoldingRegisters)
+	}
+
+	frame.Device = 3
+	response = s.route(&Request{frame: &frame, unitId: 3})
+	exception = GetException(response)
+	if exception != GatewayPathUnavailable {
+		t.Errorf("expected GatewayPathUnavailable, got %v", exception.String())
+	}
+
+	// broadcasts are executed by all units
+	frame.Device = 0
+	SetDataWithRegisterAndNumber(&frame, 2, 7)
+	if response = s.route(&Request{frame: &frame, broadcast: true}); response != nil {
+		t.Errorf("expected no response, got %v", response.Bytes())
+	}
+	if unit.HoldingRegisters[5] != 7 || s.HoldingRegisters[5] != 7 {
+		t.Errorf("expected write to all units, got %v and %v", s.HoldingRegisters, unit.HoldingRegisters)
+	}
+}
+
+func TestUnitsFunctionHandler(t *testing.T) {
+	s, _ := NewServer(1)
+	unit, _ := s.AddUnit(2)
+	unit.RegisterFunctionHandler(100, func(s *Server, frame Framer) ([]byte, *Exception) {
+		return []byte{s.slaveId}, &Success
+	})
+
+	var frame RTUFrame
+	frame.Function = 100
+
+	response := s.route(&Request{frame: &frame, unitId: 2})
+	if !isEqual([]byte{2}, response.GetData()) {
+		t.Errorf("expected %v, got %v", []byte{2}, response.GetData())
+	}
+
+	response = s.route(&Request{frame: &frame, unitId: 1})
+	exception := GetException(response)
+	if exception != IllegalFunction {
+		t.Errorf("expected IllegalFunction, got %v", exception.String())
+	}
+}
+
+func TestUnitsRequestLength(t *testing.T) {
+	s, _ := NewServer(1)
+	unit, _ := s.AddUnit(2)
+	handler := func(s *Server, frame Framer) ([]byte, *Exception) {
+		return frame.GetData(), &Success
+	}
+	unit.RegisterFunctionHandlerWithLength(101, handler, FixedRequestLength(4))
+	unit.RegisterMEIHandler(0x70, handler, FixedRequestLength(3))
+
+	for _, data := range [][]byte{
+		(&RTUFrame{Address: 2, Function: 101, Data: []byte{1, 2, 3}}).Bytes(),
+		(&RTUFrame{Address: 2, Function: 43, Data: []byte{0x70, 1}}).Bytes(),
+	} {
+		req, _, err := s.readRTU(bytes.NewBuffer(data), new([]byte))
+		if err != nil {
+			t.Errorf("expected nil, got %v\n", err)
+		}
+		if !isEqual(data, req) {
+			t.Errorf("expected %v got %v\n", data, req)
+		}
+	}
+}
+
+func TestUnitsCanNotListen(t *testing.T) {
+	s, _ := NewServer(1)
+	defer s.Close()
+	unit, _ := s.AddUnit(2)
+
+	if err := unit.ListenTCP("127.0.0.1:0"); err != errUnitListen {
+		t.Errorf("expected %v, got %v", errUnitListen, err)
+	}
+	client, server := net.Pipe()
+	defer client.Close()
+	if err := unit.ServeConn(server, FramingTCP); err != errUnitListen {
+		t.Errorf("expected %v, got %v", errUnitListen, err)
+	}
+
+	// Closing a unit leaves the server running.
+	unit.Close()
+	if s.closed() {
+		t.Errorf("expected the server not to be closed")
+	}
+}